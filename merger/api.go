@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// apiServer serves the merged dataset from the local db as read-only JSON, over REST
+// and GraphQL (POST /graphql).
+type apiServer struct {
+	db  *sqlx.DB
+	mux *http.ServeMux
+}
+
+type apiCompany struct {
+	ID           int64  `db:"id" json:"id"`
+	Name         string `db:"name" json:"name"`
+	ProblemCount int64  `db:"problem_count" json:"problem_count"`
+}
+
+// apiCompanyProblem is a problem as listed for one company.
+type apiCompanyProblem struct {
+	exportProblem
+	TimeframeTag     *string        `db:"timeframe_tag" json:"timeframe_tag"`
+	CompanyFrequency *float64       `db:"company_frequency" json:"company_frequency"` // this company's frequency
+	Tags             pq.StringArray `db:"tags" json:"tags"`
+}
+
+type apiProblemCompany struct {
+	Name         string   `db:"name" json:"name"`
+	TimeframeTag *string  `db:"timeframe_tag" json:"timeframe_tag"`
+	Frequency    *float64 `db:"frequency" json:"frequency"` // this company's frequency
+}
+
+type apiProblemDetail struct {
+	exportProblem
+	Tags      pq.StringArray      `db:"tags" json:"tags"`
+	Related   pq.Int64Array       `db:"related" json:"related"`
+	Companies []apiProblemCompany `json:"companies"`
+}
+
+type apiTag struct {
+	Tag      string `db:"tag" json:"tag"`
+	Problems int64  `db:"problems" json:"problems"`
+}
+
+// apiPage is one page of a paginated list.
+type apiPage struct {
+	Items  interface{} `json:"items"`
+	Total  int64       `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// serveMain runs the read-only HTTP API.
+// Usage: go run . serve [-addr :8080] [-cors origin]
+func serveMain(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	cors := fs.String("cors", "*", "Access-Control-Allow-Origin sent with every response (empty = none)")
+	fs.Parse(args)
+
+	godotenv.Load()
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer db.Close()
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           withCORS(*cors, newAPIServer(db)),
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+	log.Printf("serving on %s", *addr)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func newAPIServer(db *sqlx.DB) *apiServer {
+	s := &apiServer{db: db, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /companies", s.handleCompanies)
+	s.mux.HandleFunc("GET /companies/{name}/problems", s.handleCompanyProblems)
+	s.mux.HandleFunc("GET /companies/{name}/similar", s.handleSimilarCompanies)
+	s.mux.HandleFunc("GET /shared-problems", s.handleSharedProblems)
+	s.mux.HandleFunc("GET /problems/{id}", s.handleProblem)
+	s.mux.HandleFunc("GET /tags", s.handleTags)
+	s.mux.HandleFunc("GET /search", s.handleSearch)
+	s.mux.HandleFunc("GET /reviews/due", s.handleDueReviews)
+	s.mux.Handle("POST /graphql", &relay.Handler{Schema: newGraphQLSchema(db)})
+	return s
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// withCORS lets browsers on origin call the API.
+func withCORS(origin string, h http.Handler) http.Handler {
+	if origin == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// GET /companies: every company with its number of problems, by name.
+func (s *apiServer) handleCompanies(w http.ResponseWriter, r *http.Request) {
+	companies := []apiCompany{}
+	err := s.db.SelectContext(r.Context(), &companies, `
+		SELECT c.id, c.name, count(cp.problem_id) AS problem_count
+		FROM companies c
+		LEFT JOIN company_problems cp ON cp.company_id = c.id
+		GROUP BY c.id
+		ORDER BY c.name`)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, companies)
+}
+
+// GET /companies/{name}/problems?timeframe=&difficulty=&tag=&limit=&offset=
+// The tag filter may repeat (or be comma separated); a problem must carry every tag.
+// Problems are ordered by the company's frequency for them, most frequent first.
+func (s *apiServer) handleCompanyProblems(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	limit, offset, err := pageParams(q.Get("limit"), q.Get("offset"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tags := []string{} // not nil: a nil array would be sent as NULL
+	for _, t := range q["tag"] {
+		for _, tag := range splitList(t) {
+			tags = append(tags, strings.ToLower(tag))
+		}
+	}
+
+	var companyID int64
+	err = s.db.GetContext(ctx, &companyID, "SELECT id FROM companies WHERE lower(name) = lower($1)", r.PathValue("name"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("company %q not found", r.PathValue("name")))
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	filtered := `
+		WITH f AS (
+		  SELECT p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at,
+		         cp.timeframe_tag, cp.frequency AS company_frequency,
+		         COALESCE(array_agg(pt.tag ORDER BY pt.tag) FILTER (WHERE pt.tag IS NOT NULL), '{}') AS tags
+		  FROM company_problems cp
+		  JOIN problems p ON p.id = cp.problem_id
+		  LEFT JOIN problem_tags pt ON pt.problem_id = p.id
+		  WHERE cp.company_id = $1
+		    AND ($2::text = '' OR cp.timeframe_tag = $2)
+		    AND ($3::text = '' OR lower(p.difficulty) = lower($3))
+		  GROUP BY p.id, cp.timeframe_tag, cp.frequency
+		  HAVING $4::text[] <@ array_agg(lower(pt.tag))
+		)`
+	args := []interface{}{companyID, q.Get("timeframe"), q.Get("difficulty"), pq.Array(tags)}
+
+	var total int64
+	if err := s.db.GetContext(ctx, &total, filtered+" SELECT count(*) FROM f", args...); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	problems := []apiCompanyProblem{}
+	err = s.db.SelectContext(ctx, &problems,
+		filtered+" SELECT * FROM f ORDER BY company_frequency DESC NULLS LAST, id LIMIT $5 OFFSET $6",
+		append(args, limit, offset)...)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiPage{Items: problems, Total: total, Limit: limit, Offset: offset})
+}
+
+// GET /problems/{id}: one problem with its tags, related problem ids and companies.
+func (s *apiServer) handleProblem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "problem id must be an integer")
+		return
+	}
+
+	var p apiProblemDetail
+	err = s.db.GetContext(ctx, &p, `
+		SELECT p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at,
+		       ARRAY(SELECT tag FROM problem_tags WHERE problem_id = p.id ORDER BY tag) AS tags,
+		       ARRAY(SELECT related_id FROM problem_relations WHERE problem_id = p.id ORDER BY related_id) AS related
+		FROM problems p
+		WHERE p.id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("problem %d not found", id))
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	p.Companies = []apiProblemCompany{}
+	err = s.db.SelectContext(ctx, &p.Companies, `
+		SELECT c.name, cp.timeframe_tag, cp.frequency
+		FROM company_problems cp
+		JOIN companies c ON c.id = cp.company_id
+		WHERE cp.problem_id = $1
+		ORDER BY c.name`, id)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// GET /tags: every tag with its number of problems, by name.
+func (s *apiServer) handleTags(w http.ResponseWriter, r *http.Request) {
+	tags := []apiTag{}
+	err := s.db.SelectContext(r.Context(), &tags, `
+		SELECT tag, count(*) AS problems
+		FROM problem_tags
+		GROUP BY tag
+		ORDER BY tag`)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// pageParams parses limit and offset, applying the default and maximum page size.
+func pageParams(limitStr, offsetStr string) (limit, offset int, err error) {
+	limit = defaultPageSize
+	if limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("limit must be a positive integer")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+	}
+	if offsetStr != "" {
+		if offset, err = strconv.Atoi(offsetStr); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+func (s *apiServer) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return // the client went away
+	}
+	log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// Similarity methods stored in company_similarity.method.
+const (
+	// similarityJaccard is shared problems / problems asked by either company.
+	similarityJaccard = "jaccard"
+	// similarityWeighted is weighted Jaccard over the companies' own frequencies:
+	// sum(min(wa, wb)) over shared problems / (sum(wa) + sum(wb) - that sum). Like
+	// Jaccard it is symmetric and between 0 and 1; overlap on frequently asked problems
+	// counts more.
+	similarityWeighted = "weighted"
+)
+
+// defaultSimilarTop is how many similar companies are kept per company and method.
+const defaultSimilarTop = 20
+
+// companySimilaritySpec pushes the materialized similarities with the dataset. Every
+// recompute rewrites a method's rows with one computed_at, so the delta holds whole
+// methods, and the push replaces a method's remote rows rather than upserting them:
+// pairs that dropped out of a top-N list must not linger as duplicate ranks.
+var companySimilaritySpec = tableSpec{
+	Name:      "company_similarity",
+	Columns:   []string{"company_id", "similar_id", "method", "score", "shared_problems", "rank", "computed_at"},
+	Key:       []string{"company_id", "similar_id", "method"},
+	Update:    []string{"score", "shared_problems", "rank", "computed_at"},
+	Watermark: "computed_at",
+	Replace:   []string{"method"},
+}
+
+type similarCompany struct {
+	ID     int64   `db:"id" json:"id"`
+	Name   string  `db:"name" json:"name"`
+	Score  float64 `db:"score" json:"score"`
+	Shared int64   `db:"shared_problems" json:"shared_problems"`
+	Rank   int64   `db:"rank" json:"rank"`
+}
+
+type sharedProblem struct {
+	exportProblem
+	Tags pq.StringArray `db:"tags" json:"tags"`
+	// CompanyFrequency is the mean of the companies' own frequencies for the problem.
+	CompanyFrequency *float64 `db:"company_frequency" json:"company_frequency"`
+}
+
+// computeCompanySimilarity replaces the rows of method in company_similarity with the
+// top most similar companies of every company, in one transaction.
+func computeCompanySimilarity(ctx context.Context, db *sqlx.DB, method string, top int) (int64, error) {
+	var score string
+	switch method {
+	case similarityJaccard:
+		score = "pr.shared::real / (sa.n + sb.n - pr.shared)"
+	case similarityWeighted:
+		score = "pr.shared_w / NULLIF(sa.w + sb.w - pr.shared_w, 0)"
+	default:
+		return 0, fmt.Errorf("unknown method %q (want %s or %s)", method, similarityJaccard, similarityWeighted)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM company_similarity WHERE method = $1", method); err != nil {
+		return 0, fmt.Errorf("clear %s: %w", method, err)
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		WITH cp AS (
+		  SELECT company_id, problem_id, greatest(coalesce(frequency, 0), 0) AS w
+		  FROM company_problems
+		),
+		sizes AS (
+		  SELECT company_id, count(*) AS n, sum(w) AS w FROM cp GROUP BY company_id
+		),
+		pairs AS (
+		  SELECT a.company_id, b.company_id AS similar_id, count(*) AS shared, sum(least(a.w, b.w)) AS shared_w
+		  FROM cp a
+		  JOIN cp b ON b.problem_id = a.problem_id AND b.company_id <> a.company_id
+		  GROUP BY a.company_id, b.company_id
+		),
+		scored AS (
+		  SELECT pr.company_id, pr.similar_id, pr.shared, %s AS score
+		  FROM pairs pr
+		  JOIN sizes sa ON sa.company_id = pr.company_id
+		  JOIN sizes sb ON sb.company_id = pr.similar_id
+		),
+		ranked AS (
+		  SELECT *, row_number() OVER (PARTITION BY company_id ORDER BY score DESC, shared DESC, similar_id) AS rank
+		  FROM scored
+		  WHERE score IS NOT NULL
+		)
+		INSERT INTO company_similarity (company_id, similar_id, method, score, shared_problems, rank, computed_at)
+		SELECT company_id, similar_id, $1, score, shared, rank, now()
+		FROM ranked
+		WHERE rank <= $2`, score), method, top)
+	if err != nil {
+		return 0, fmt.Errorf("compute %s: %w", method, err)
+	}
+	n, _ := res.RowsAffected()
+	return n, tx.Commit()
+}
+
+// similarCompanies reads the stored top similar companies of companyID.
+func similarCompanies(ctx context.Context, db *sqlx.DB, companyID int64, method string, limit int) ([]similarCompany, error) {
+	out := []similarCompany{}
+	err := db.SelectContext(ctx, &out, `
+		SELECT c.id, c.name, s.score, s.shared_problems, s.rank
+		FROM company_similarity s
+		JOIN companies c ON c.id = s.similar_id
+		WHERE s.company_id = $1 AND s.method = $2
+		ORDER BY s.rank
+		LIMIT $3`, companyID, method, limit)
+	return out, err
+}
+
+// sharedProblems lists the problems asked by every one of companyIDs, most frequent first
+// by the mean of those companies' frequencies.
+func sharedProblems(ctx context.Context, db *sqlx.DB, companyIDs []int64, limit int) ([]sharedProblem, error) {
+	seen := map[int64]bool{}
+	var ids pq.Int64Array
+	for _, id := range companyIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	out := []sharedProblem{}
+	err := db.SelectContext(ctx, &out, `
+		SELECT p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at,
+		       ARRAY(SELECT tag FROM problem_tags WHERE problem_id = p.id ORDER BY tag) AS tags,
+		       s.company_frequency
+		FROM problems p
+		JOIN (
+		  SELECT problem_id, avg(frequency) AS company_frequency FROM company_problems
+		  WHERE company_id = ANY($1)
+		  GROUP BY problem_id
+		  HAVING count(DISTINCT company_id) = cardinality($1)
+		) s ON s.problem_id = p.id
+		ORDER BY s.company_frequency DESC NULLS LAST, p.id
+		LIMIT $2`, ids, limit)
+	return out, err
+}
+
+// companyIDByName resolves a company name case-insensitively; sql.ErrNoRows if unknown.
+func companyIDByName(ctx context.Context, db *sqlx.DB, name string) (int64, error) {
+	var id int64
+	err := db.GetContext(ctx, &id, "SELECT id FROM companies WHERE lower(name) = lower($1)", name)
+	return id, err
+}
+
+// similarMain computes company similarities, or queries them.
+// Usage: go run . similar -compute [-method m] [-top N]
+//
+//	go run . similar [-method m] [-limit N] company           (most similar companies)
+//	go run . similar [-limit N] company1 company2 ...         (problems they all ask)
+func similarMain(args []string) {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	compute := fs.Bool("compute", false, "recompute company_similarity from company_problems")
+	method := fs.String("method", similarityJaccard, "jaccard or weighted (with -compute: also both)")
+	top := fs.Int("top", defaultSimilarTop, "with -compute, similar companies kept per company")
+	limit := fs.Int("limit", 20, "rows to print")
+	fs.Parse(args)
+
+	godotenv.Load()
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if *compute {
+		methods := []string{*method}
+		if *method == "both" {
+			methods = []string{similarityJaccard, similarityWeighted}
+		}
+		for _, m := range methods {
+			n, err := computeCompanySimilarity(ctx, db, m, *top)
+			if err != nil {
+				log.Fatalf("compute similarity: %v", err)
+			}
+			log.Printf("company_similarity: %d %s rows (top %d per company)", n, m, *top)
+		}
+		return
+	}
+	if fs.NArg() == 0 {
+		log.Fatalf("usage: similar -compute | similar company | similar company1 company2 ...")
+	}
+
+	ids := make([]int64, fs.NArg())
+	for i, name := range fs.Args() {
+		if ids[i], err = companyIDByName(ctx, db, name); err != nil {
+			log.Fatalf("company %q: %v", name, err)
+		}
+	}
+
+	if len(ids) == 1 {
+		similar, err := similarCompanies(ctx, db, ids[0], *method, *limit)
+		if err != nil {
+			log.Fatalf("similar companies: %v", err)
+		}
+		if len(similar) == 0 {
+			fmt.Printf("no %s similarities stored for %s; run similar -compute first\n", *method, fs.Arg(0))
+		}
+		for _, s := range similar {
+			fmt.Printf("%3d. %-30s %.3f  (%d shared problems)\n", s.Rank, s.Name, s.Score, s.Shared)
+		}
+		return
+	}
+
+	problems, err := sharedProblems(ctx, db, ids, *limit)
+	if err != nil {
+		log.Fatalf("shared problems: %v", err)
+	}
+	for _, p := range problems {
+		fmt.Printf("%5d  %-6s  %s\n", p.ID, derefString(p.Difficulty), derefString(p.Title))
+	}
+	fmt.Printf("%d problems asked by all %d companies\n", len(problems), len(ids))
+}
+
+// GET /companies/{name}/similar?method=&limit=
+func (s *apiServer) handleSimilarCompanies(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Query().Get("method")
+	if method == "" {
+		method = similarityJaccard
+	}
+	if method != similarityJaccard && method != similarityWeighted {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown method %q (want %s or %s)", method, similarityJaccard, similarityWeighted))
+		return
+	}
+	limit, _, err := pageParams(r.URL.Query().Get("limit"), "")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := companyIDByName(r.Context(), s.db, r.PathValue("name"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("company %q not found", r.PathValue("name")))
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	similar, err := similarCompanies(r.Context(), s.db, id, method, limit)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, similar)
+}
+
+// GET /shared-problems?company=a&company=b[&limit=]: problems asked by all given companies.
+func (s *apiServer) handleSharedProblems(w http.ResponseWriter, r *http.Request) {
+	names := r.URL.Query()["company"]
+	if len(names) < 2 {
+		writeError(w, http.StatusBadRequest, "give at least two company parameters")
+		return
+	}
+	limit, _, err := pageParams(r.URL.Query().Get("limit"), "")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ids := make([]int64, len(names))
+	for i, name := range names {
+		ids[i], err = companyIDByName(r.Context(), s.db, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("company %q not found", name))
+			return
+		}
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+	}
+	problems, err := sharedProblems(r.Context(), s.db, ids, limit)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, problems)
+}
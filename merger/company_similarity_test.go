@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestComputeCompanySimilarityWeighted(t *testing.T) {
+	db := testPostgres(t)
+	// Google and Amazon share problem 1 but weigh it very differently
+	db.MustExec(`
+		INSERT INTO companies (id, name) VALUES (1, 'Google'), (2, 'Amazon'), (3, 'Meta');
+		INSERT INTO problems (id) VALUES (1), (2), (3);
+		INSERT INTO company_problems (company_id, problem_id, frequency) VALUES
+		  (1, 1, 10), (1, 2, 20),
+		  (2, 1, 100), (2, 3, 5),
+		  (3, 2, 20), (3, 3, NULL);`)
+
+	if _, err := computeCompanySimilarity(context.Background(), db, similarityWeighted, 20); err != nil {
+		t.Fatalf("computeCompanySimilarity: %v", err)
+	}
+	var rows []struct {
+		CompanyID int64   `db:"company_id"`
+		SimilarID int64   `db:"similar_id"`
+		Score     float64 `db:"score"`
+	}
+	if err := db.Select(&rows, "SELECT company_id, similar_id, score FROM company_similarity WHERE method = 'weighted'"); err != nil {
+		t.Fatal(err)
+	}
+	scores := map[[2]int64]float64{}
+	for _, r := range rows {
+		if r.Score < 0 || r.Score > 1 {
+			t.Errorf("score(%d, %d) = %v, want within 0-1", r.CompanyID, r.SimilarID, r.Score)
+		}
+		scores[[2]int64{r.CompanyID, r.SimilarID}] = r.Score
+	}
+	for pair, s := range scores {
+		back, ok := scores[[2]int64{pair[1], pair[0]}]
+		if !ok || math.Abs(s-back) > 1e-6 {
+			t.Errorf("score%v = %v but the reverse is %v (present %v)", pair, s, back, ok)
+		}
+	}
+
+	want := map[[2]int64]float64{
+		{1, 2}: 10.0 / (30 + 105 - 10), // min(10, 100) over the union
+		{1, 3}: 20.0 / (30 + 20 - 20),
+		// Amazon and Meta share problem 3, which Meta gives no frequency: weight 0
+		{2, 3}: 0,
+	}
+	for pair, w := range want {
+		if got, ok := scores[pair]; !ok || math.Abs(got-w) > 1e-6 {
+			t.Errorf("score%v = %v (present %v), want %v", pair, got, ok, w)
+		}
+	}
+}
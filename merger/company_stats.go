@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+)
+
+// companyStatsTopTags is how many tags company_stats.top_tags keeps.
+const companyStatsTopTags = 10
+
+// companyStatsSpec pushes the per-company aggregates with the dataset.
+var companyStatsSpec = tableSpec{
+	Name: "company_stats",
+	Columns: []string{"company_id", "problem_count", "by_difficulty", "by_tag", "by_timeframe",
+		"avg_acceptance", "top_tags", "computed_at"},
+	Key: []string{"company_id"},
+	Update: []string{"problem_count", "by_difficulty", "by_tag", "by_timeframe",
+		"avg_acceptance", "top_tags", "computed_at"},
+	Watermark: "computed_at",
+}
+
+type companyStats struct {
+	CompanyID     int64    `db:"company_id"`
+	Name          string   `db:"name"`
+	ProblemCount  int64    `db:"problem_count"`
+	ByDifficulty  []byte   `db:"by_difficulty"`
+	ByTag         []byte   `db:"by_tag"`
+	ByTimeframe   []byte   `db:"by_timeframe"`
+	AvgAcceptance *float64 `db:"avg_acceptance"`
+	TopTags       []byte   `db:"top_tags"`
+}
+
+// refreshCompanyStats recomputes company_stats from company_problems, problems and
+// problem_tags. A row's computed_at only moves when its aggregates changed, so the
+// delta sync pushes just those. Companies without problems lose their row.
+func refreshCompanyStats(db *sqlx.DB) (int64, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		WITH cp AS (
+		  SELECT cp.company_id, cp.problem_id, cp.timeframe_tag, p.difficulty, p.acceptance,
+		         coalesce(cp.frequency, 0) AS w
+		  FROM company_problems cp
+		  JOIN problems p ON p.id = cp.problem_id
+		),
+		base AS (
+		  SELECT company_id, count(*) AS n, avg(acceptance) AS avg_acceptance
+		  FROM cp GROUP BY company_id
+		),
+		difficulty AS (
+		  SELECT company_id, jsonb_object_agg(d, n) AS j
+		  FROM (SELECT company_id, coalesce(difficulty, 'Unknown') AS d, count(*) AS n FROM cp GROUP BY 1, 2) x
+		  GROUP BY company_id
+		),
+		timeframe AS (
+		  SELECT company_id, jsonb_object_agg(t, n) AS j
+		  FROM (SELECT company_id, coalesce(timeframe_tag, 'none') AS t, count(*) AS n FROM cp GROUP BY 1, 2) x
+		  GROUP BY company_id
+		),
+		tag_counts AS (
+		  SELECT cp.company_id, pt.tag, count(*) AS n, sum(cp.w) AS weight,
+		         row_number() OVER (PARTITION BY cp.company_id ORDER BY sum(cp.w) DESC, count(*) DESC, pt.tag) AS rank
+		  FROM cp
+		  JOIN problem_tags pt ON pt.problem_id = cp.problem_id
+		  GROUP BY cp.company_id, pt.tag
+		),
+		tags AS (
+		  SELECT company_id,
+		         jsonb_object_agg(tag, n) AS j,
+		         jsonb_agg(jsonb_build_object('tag', tag, 'count', n, 'weight', round(weight::numeric, 3)) ORDER BY rank)
+		           FILTER (WHERE rank <= $1) AS top
+		  FROM tag_counts
+		  GROUP BY company_id
+		)
+		INSERT INTO company_stats AS s (company_id, problem_count, by_difficulty, by_tag, by_timeframe,
+		                                avg_acceptance, top_tags, computed_at)
+		SELECT b.company_id, b.n, coalesce(d.j, '{}'), coalesce(t.j, '{}'), coalesce(tf.j, '{}'),
+		       b.avg_acceptance, coalesce(t.top, '[]'), now()
+		FROM base b
+		LEFT JOIN difficulty d ON d.company_id = b.company_id
+		LEFT JOIN timeframe tf ON tf.company_id = b.company_id
+		LEFT JOIN tags t ON t.company_id = b.company_id
+		ON CONFLICT (company_id) DO UPDATE
+		  SET problem_count = EXCLUDED.problem_count,
+		      by_difficulty = EXCLUDED.by_difficulty,
+		      by_tag = EXCLUDED.by_tag,
+		      by_timeframe = EXCLUDED.by_timeframe,
+		      avg_acceptance = EXCLUDED.avg_acceptance,
+		      top_tags = EXCLUDED.top_tags,
+		      computed_at = now()
+		  WHERE (s.problem_count, s.by_difficulty, s.by_tag, s.by_timeframe, s.avg_acceptance, s.top_tags)
+		        IS DISTINCT FROM
+		        (EXCLUDED.problem_count, EXCLUDED.by_difficulty, EXCLUDED.by_tag, EXCLUDED.by_timeframe,
+		         EXCLUDED.avg_acceptance, EXCLUDED.top_tags)
+	`, companyStatsTopTags)
+	if err != nil {
+		return 0, fmt.Errorf("upsert company_stats: %w", err)
+	}
+	changed, _ := res.RowsAffected()
+
+	if _, err := tx.Exec(`
+		DELETE FROM company_stats s
+		WHERE NOT EXISTS (SELECT 1 FROM company_problems cp WHERE cp.company_id = s.company_id)`); err != nil {
+		return 0, fmt.Errorf("delete stale company_stats: %w", err)
+	}
+	return changed, tx.Commit()
+}
+
+// refreshDerived rebuilds everything computed from the ingested data. It runs at the end
+// of every ingest; failures are only logged, since the ingested rows are committed already.
+func refreshDerived(db *sqlx.DB) {
+	if n, err := refreshPopularity(db); err != nil {
+		log.Printf("refresh popularity: %v", err)
+	} else {
+		log.Printf("popularity: %d problems changed", n)
+	}
+	if err := refreshSearchIndex(db); err != nil {
+		log.Printf("refresh search index: %v", err)
+	}
+	if n, err := refreshCompanyStats(db); err != nil {
+		log.Printf("refresh company stats: %v", err)
+	} else {
+		log.Printf("company_stats: %d companies changed", n)
+	}
+}
+
+// statsMain refreshes company_stats or problems.popularity, or prints one company's profile.
+// Usage: go run . stats -refresh
+//
+//	go run . stats -popularity
+//
+//	go run . stats company
+func statsMain(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	refresh := fs.Bool("refresh", false, "recompute company_stats")
+	popularity := fs.Bool("popularity", false, "recompute problems.popularity")
+	fs.Parse(args)
+
+	godotenv.Load()
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer db.Close()
+
+	if *popularity {
+		n, err := refreshPopularity(db)
+		if err != nil {
+			log.Fatalf("refresh popularity: %v", err)
+		}
+		log.Printf("popularity: %d problems changed", n)
+		return
+	}
+	if *refresh {
+		n, err := refreshCompanyStats(db)
+		if err != nil {
+			log.Fatalf("refresh company stats: %v", err)
+		}
+		log.Printf("company_stats: %d companies changed", n)
+		return
+	}
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: stats -refresh | stats -popularity | stats company")
+	}
+
+	var st companyStats
+	err = db.Get(&st, `
+		SELECT s.company_id, c.name, s.problem_count, s.by_difficulty, s.by_tag, s.by_timeframe,
+		       s.avg_acceptance, s.top_tags
+		FROM company_stats s
+		JOIN companies c ON c.id = s.company_id
+		WHERE lower(c.name) = lower($1)`, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("stats for %q: %v (run stats -refresh if the company exists)", fs.Arg(0), err)
+	}
+
+	fmt.Printf("%s: %d problems", st.Name, st.ProblemCount)
+	if st.AvgAcceptance != nil {
+		fmt.Printf(", average acceptance %.1f%%", *st.AvgAcceptance)
+	}
+	fmt.Println()
+	for _, part := range []struct {
+		label string
+		raw   []byte
+	}{{"difficulty", st.ByDifficulty}, {"timeframe", st.ByTimeframe}} {
+		var counts map[string]int
+		if err := json.Unmarshal(part.raw, &counts); err != nil {
+			log.Fatalf("decode %s: %v", part.label, err)
+		}
+		fmt.Printf("  by %-10s %s\n", part.label+":", formatTagCounts(counts))
+	}
+
+	var top []struct {
+		Tag    string  `json:"tag"`
+		Count  int     `json:"count"`
+		Weight float64 `json:"weight"`
+	}
+	if err := json.Unmarshal(st.TopTags, &top); err != nil {
+		log.Fatalf("decode top tags: %v", err)
+	}
+	fmt.Println("  top tags by weighted frequency:")
+	for i, t := range top {
+		fmt.Printf("  %2d. %-30s %4d problems  weight %.2f\n", i+1, t.Tag, t.Count, t.Weight)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Rows as exported. Nullable columns are pointers, which JSON writes as null and
+// Parquet as optional fields.
+type exportCompany struct {
+	ID   int64  `db:"id" json:"id" parquet:"id"`
+	Name string `db:"name" json:"name" parquet:"name"`
+}
+
+type exportProblem struct {
+	ID         int64     `db:"id" json:"id" parquet:"id"`
+	URL        *string   `db:"url" json:"url" parquet:"url,optional"`
+	Title      *string   `db:"title" json:"title" parquet:"title,optional"`
+	Difficulty *string   `db:"difficulty" json:"difficulty" parquet:"difficulty,optional"`
+	Acceptance *float64  `db:"acceptance" json:"acceptance" parquet:"acceptance,optional"`
+	Frequency  *float64  `db:"frequency" json:"frequency" parquet:"frequency,optional"`
+	Popularity *float64  `db:"popularity" json:"popularity" parquet:"popularity,optional"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at" parquet:"updated_at,timestamp"`
+}
+
+type exportCompanyProblem struct {
+	CompanyID    int64     `db:"company_id" json:"company_id" parquet:"company_id"`
+	ProblemID    int64     `db:"problem_id" json:"problem_id" parquet:"problem_id"`
+	SourceFile   *string   `db:"source_file" json:"source_file" parquet:"source_file,optional"`
+	TimeframeTag *string   `db:"timeframe_tag" json:"timeframe_tag" parquet:"timeframe_tag,optional"`
+	Frequency    *float64  `db:"frequency" json:"frequency" parquet:"frequency,optional"`
+	LastSeen     time.Time `db:"last_seen" json:"last_seen" parquet:"last_seen,timestamp"`
+}
+
+type exportProblemTag struct {
+	ProblemID int64     `db:"problem_id" json:"problem_id" parquet:"problem_id"`
+	Tag       string    `db:"tag" json:"tag" parquet:"tag"`
+	AddedAt   time.Time `db:"added_at" json:"added_at" parquet:"added_at,timestamp"`
+}
+
+// exportDataset is everything a bundle is built from.
+type exportDataset struct {
+	Companies       []exportCompany
+	Problems        []exportProblem
+	CompanyProblems []exportCompanyProblem
+	ProblemTags     []exportProblemTag
+}
+
+// companyFileProblem is one problem in a per-company JSON file.
+type companyFileProblem struct {
+	exportProblem
+	TimeframeTag *string  `json:"timeframe_tag"`
+	Tags         []string `json:"tags"`
+}
+
+type companyFile struct {
+	Company  exportCompany        `json:"company"`
+	Problems []companyFileProblem `json:"problems"`
+}
+
+// bundleManifest describes a bundle: row counts and a SHA-256 per file. Checksum covers
+// every "<path> <sha256>" line in path order, so it changes when any file does.
+type bundleManifest struct {
+	Version     string           `json:"version"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Counts      map[string]int   `json:"counts"`
+	Files       []bundleFileInfo `json:"files"`
+	Checksum    string           `json:"checksum"`
+}
+
+type bundleFileInfo struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// exportMain writes the local dataset to a static, versioned bundle.
+// Usage: go run . export [-out dir] [-version v]
+func exportMain(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("out", "export", "directory the versioned bundles are written to")
+	version := fs.String("version", time.Now().UTC().Format("20060102-150405"), "bundle version (subdirectory name)")
+	fs.Parse(args)
+
+	godotenv.Load()
+
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer db.Close()
+
+	dir := filepath.Join(*out, *version)
+	if _, err := os.Stat(dir); err == nil {
+		log.Fatalf("bundle %s already exists; bundles are immutable, pick another -version", dir)
+	}
+
+	data, err := loadExportDataset(db)
+	if err != nil {
+		log.Fatalf("load dataset: %v", err)
+	}
+	manifest, err := writeBundle(dir, *version, data)
+	if err != nil {
+		log.Fatalf("write bundle: %v", err)
+	}
+	log.Printf("bundle %s written to %s: %d files, checksum %s", *version, dir, len(manifest.Files), manifest.Checksum)
+}
+
+// loadExportDataset reads the four dataset tables from the local db.
+func loadExportDataset(db *sqlx.DB) (*exportDataset, error) {
+	var d exportDataset
+	if err := db.Select(&d.Companies, "SELECT id, name FROM companies ORDER BY id"); err != nil {
+		return nil, fmt.Errorf("companies: %w", err)
+	}
+	if err := db.Select(&d.Problems, `
+		SELECT id, url, title, difficulty, acceptance, frequency, popularity, updated_at
+		FROM problems ORDER BY id`); err != nil {
+		return nil, fmt.Errorf("problems: %w", err)
+	}
+	if err := db.Select(&d.CompanyProblems, `
+		SELECT company_id, problem_id, source_file, timeframe_tag, frequency, last_seen
+		FROM company_problems ORDER BY company_id, problem_id`); err != nil {
+		return nil, fmt.Errorf("company_problems: %w", err)
+	}
+	if err := db.Select(&d.ProblemTags, `
+		SELECT problem_id, tag, added_at
+		FROM problem_tags ORDER BY problem_id, tag`); err != nil {
+		return nil, fmt.Errorf("problem_tags: %w", err)
+	}
+	return &d, nil
+}
+
+// writeBundle writes per-company JSON, the combined CSV, one Parquet file per table and
+// the manifest into dir.
+func writeBundle(dir, version string, d *exportDataset) (*bundleManifest, error) {
+	for _, sub := range []string{"companies", "parquet"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	problems := map[int64]exportProblem{}
+	for _, p := range d.Problems {
+		problems[p.ID] = p
+	}
+	tags := map[int64][]string{}
+	for _, t := range d.ProblemTags {
+		tags[t.ProblemID] = append(tags[t.ProblemID], t.Tag)
+	}
+	byCompany := map[int64][]exportCompanyProblem{}
+	for _, cp := range d.CompanyProblems {
+		byCompany[cp.CompanyID] = append(byCompany[cp.CompanyID], cp)
+	}
+
+	var files []string
+
+	// per-company JSON
+	used := map[string]bool{}
+	for _, c := range d.Companies {
+		name := fileSlug(c.Name)
+		if used[name] {
+			name = fmt.Sprintf("%s-%d", name, c.ID)
+		}
+		used[name] = true
+
+		cf := companyFile{Company: c, Problems: []companyFileProblem{}}
+		for _, cp := range byCompany[c.ID] {
+			cf.Problems = append(cf.Problems, companyFileProblem{
+				exportProblem: problems[cp.ProblemID],
+				TimeframeTag:  cp.TimeframeTag,
+				Tags:          nonNil(tags[cp.ProblemID]),
+			})
+		}
+		rel := filepath.Join("companies", name+".json")
+		if err := writeJSONFile(filepath.Join(dir, rel), cf); err != nil {
+			return nil, err
+		}
+		files = append(files, rel)
+	}
+
+	// combined CSV: one row per company problem
+	if err := writeCombinedCSV(filepath.Join(dir, "visor.csv"), d, problems, tags); err != nil {
+		return nil, err
+	}
+	files = append(files, "visor.csv")
+
+	// Parquet, one file per table
+	parquetFiles := []struct {
+		name  string
+		write func(path string) error
+	}{
+		{"companies", func(p string) error { return parquet.WriteFile(p, d.Companies) }},
+		{"problems", func(p string) error { return parquet.WriteFile(p, d.Problems) }},
+		{"company_problems", func(p string) error { return parquet.WriteFile(p, d.CompanyProblems) }},
+		{"problem_tags", func(p string) error { return parquet.WriteFile(p, d.ProblemTags) }},
+	}
+	for _, pf := range parquetFiles {
+		rel := filepath.Join("parquet", pf.name+".parquet")
+		if err := pf.write(filepath.Join(dir, rel)); err != nil {
+			return nil, fmt.Errorf("write %s: %w", rel, err)
+		}
+		files = append(files, rel)
+	}
+
+	m := &bundleManifest{
+		Version:     version,
+		GeneratedAt: time.Now().UTC(),
+		Counts: map[string]int{
+			"companies":        len(d.Companies),
+			"problems":         len(d.Problems),
+			"company_problems": len(d.CompanyProblems),
+			"problem_tags":     len(d.ProblemTags),
+		},
+	}
+	sort.Strings(files)
+	sum := sha256.New()
+	for _, rel := range files {
+		info, err := hashFile(filepath.Join(dir, rel))
+		if err != nil {
+			return nil, err
+		}
+		info.Path = filepath.ToSlash(rel)
+		m.Files = append(m.Files, info)
+		fmt.Fprintf(sum, "%s %s\n", info.Path, info.SHA256)
+	}
+	m.Checksum = hex.EncodeToString(sum.Sum(nil))
+
+	if err := writeJSONFile(filepath.Join(dir, "manifest.json"), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func writeCombinedCSV(path string, d *exportDataset, problems map[int64]exportProblem, tags map[int64][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	companyNames := map[int64]string{}
+	for _, c := range d.Companies {
+		companyNames[c.ID] = c.Name
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"company", "problem_id", "title", "url", "difficulty", "acceptance", "frequency", "popularity", "timeframe_tag", "tags"})
+	for _, cp := range d.CompanyProblems {
+		p := problems[cp.ProblemID]
+		w.Write([]string{
+			companyNames[cp.CompanyID],
+			strconv.FormatInt(cp.ProblemID, 10),
+			derefString(p.Title),
+			derefString(p.URL),
+			derefString(p.Difficulty),
+			formatOptionalFloat(p.Acceptance),
+			formatOptionalFloat(p.Frequency),
+			formatOptionalFloat(p.Popularity),
+			derefString(cp.TimeframeTag),
+			strings.Join(tags[cp.ProblemID], ";"),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+func hashFile(path string) (bundleFileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return bundleFileInfo{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return bundleFileInfo{}, err
+	}
+	return bundleFileInfo{Bytes: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// fileSlug turns a company name into a safe file name: lower case, [a-z0-9-] only.
+func fileSlug(name string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	s := strings.TrimSuffix(sb.String(), "-")
+	if s == "" {
+		s = "company"
+	}
+	return s
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatOptionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeLeetCodeOptions controls the fake LeetCode GraphQL server.
+type fakeLeetCodeOptions struct {
+	// FixturesDir holds one <titleSlug>.json per question, shaped like LeetCode's
+	// question object: {"questionId", "questionFrontendId", "topicTags", "similarQuestions"}.
+	FixturesDir string
+	// RateLimitEvery answers every Nth request with 429 (0 disables it).
+	RateLimitEvery int
+	// RateLimitFirst answers the first N requests with 429.
+	RateLimitFirst int
+	// Delay is slept before every answer; longer than the client timeout simulates timeouts.
+	Delay time.Duration
+	// ErrorSlugs are answered with a null alias and an entry in "errors", like a partial failure.
+	ErrorSlugs []string
+}
+
+// aliasRe matches `q0: question(titleSlug: $s0)` as produced by buildBatchQuery,
+// and the literal form `q0: question(titleSlug: "two-sum")`.
+var aliasRe = regexp.MustCompile(`(\w+)\s*:\s*question\(\s*titleSlug\s*:\s*(\$\w+|"(?:[^"\\]|\\.)*")\s*\)`)
+
+// fakeLeetCode is a running fake server and the number of requests it received.
+type fakeLeetCode struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests int
+}
+
+func (f *fakeLeetCode) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// newFakeLeetCode starts an httptest server answering aliased question(titleSlug:) queries
+// from local fixtures. Callers must Close it.
+func newFakeLeetCode(opts fakeLeetCodeOptions) *fakeLeetCode {
+	errorSlugs := map[string]bool{}
+	for _, s := range opts.ErrorSlugs {
+		errorSlugs[s] = true
+	}
+
+	f := &fakeLeetCode{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests++
+		n := f.requests
+		f.mu.Unlock()
+
+		if opts.Delay > 0 {
+			select {
+			case <-time.After(opts.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if n <= opts.RateLimitFirst || (opts.RateLimitEvery > 0 && n%opts.RateLimitEvery == 0) {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var body graphqlRequest
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&body) != nil {
+			http.Error(w, "expected a JSON POST body", http.StatusBadRequest)
+			return
+		}
+
+		data := map[string]json.RawMessage{}
+		var errs []graphqlError
+		for _, m := range aliasRe.FindAllStringSubmatch(body.Query, -1) {
+			alias := m[1]
+			slug, ok := fakeSlugArg(m[2], body.Variables)
+			if !ok {
+				http.Error(w, "bad titleSlug argument "+m[2], http.StatusBadRequest)
+				return
+			}
+
+			fixture, err := os.ReadFile(filepath.Join(opts.FixturesDir, filepath.Base(slug)+".json"))
+			switch {
+			case errorSlugs[slug]:
+				data[alias] = json.RawMessage("null")
+				errs = append(errs, graphqlError{Message: "simulated error for " + slug, Path: []interface{}{alias}})
+			case err != nil:
+				// LeetCode answers unknown slugs with null and an error on that alias
+				data[alias] = json.RawMessage("null")
+				errs = append(errs, graphqlError{Message: "That question does not exist.", Path: []interface{}{alias}})
+			default:
+				data[alias] = json.RawMessage(fixture)
+			}
+		}
+
+		resp := map[string]interface{}{"data": data}
+		if len(errs) > 0 {
+			resp["errors"] = errs
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	return f
+}
+
+// fakeSlugArg resolves a titleSlug argument, either a $variable or a string literal.
+func fakeSlugArg(arg string, vars map[string]interface{}) (string, bool) {
+	if strings.HasPrefix(arg, "$") {
+		v, ok := vars[arg[1:]].(string)
+		return v, ok
+	}
+	s, err := strconv.Unquote(arg)
+	return s, err == nil
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// foreignKey is a foreign key constraint between two tables of the current schema.
+type foreignKey struct {
+	Name          string         `db:"name"`
+	Child         string         `db:"child_table"`
+	Parent        string         `db:"parent_table"`
+	ChildColumns  pq.StringArray `db:"child_columns"`
+	ParentColumns pq.StringArray `db:"parent_columns"`
+}
+
+// foreignKeys lists the foreign keys declared on tables (in the current schema).
+func foreignKeys(ctx context.Context, db sqlx.ExtContext, tables []string) ([]foreignKey, error) {
+	var fks []foreignKey
+	err := sqlx.SelectContext(ctx, db, &fks, `
+		SELECT c.conname AS name,
+		       ch.relname AS child_table,
+		       pa.relname AS parent_table,
+		       ARRAY(SELECT a.attname::text
+		             FROM unnest(c.conkey) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		             ORDER BY k.ord) AS child_columns,
+		       ARRAY(SELECT a.attname::text
+		             FROM unnest(c.confkey) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.attnum
+		             ORDER BY k.ord) AS parent_columns
+		FROM pg_constraint c
+		JOIN pg_class ch ON ch.oid = c.conrelid
+		JOIN pg_class pa ON pa.oid = c.confrelid
+		JOIN pg_namespace n ON n.oid = ch.relnamespace
+		WHERE c.contype = 'f'
+		  AND n.nspname = current_schema()
+		  AND ch.relname = ANY($1)
+		ORDER BY ch.relname, c.conname
+	`, pq.Array(tables))
+	return fks, err
+}
+
+// cascadingForeignKeys lists the ON DELETE CASCADE foreign keys pointing at table (in the
+// current schema), whether or not their child tables are synced.
+func cascadingForeignKeys(ctx context.Context, db sqlx.QueryerContext, table string) ([]foreignKey, error) {
+	var fks []foreignKey
+	err := sqlx.SelectContext(ctx, db, &fks, `
+		SELECT c.conname AS name,
+		       ch.relname AS child_table,
+		       pa.relname AS parent_table,
+		       ARRAY(SELECT a.attname::text
+		             FROM unnest(c.conkey) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		             ORDER BY k.ord) AS child_columns,
+		       ARRAY(SELECT a.attname::text
+		             FROM unnest(c.confkey) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.attnum
+		             ORDER BY k.ord) AS parent_columns
+		FROM pg_constraint c
+		JOIN pg_class ch ON ch.oid = c.conrelid
+		JOIN pg_class pa ON pa.oid = c.confrelid
+		JOIN pg_namespace n ON n.oid = pa.relnamespace
+		WHERE c.contype = 'f'
+		  AND c.confdeltype = 'c'
+		  AND n.nspname = current_schema()
+		  AND pa.relname = $1
+		ORDER BY ch.relname, c.conname
+	`, table)
+	return fks, err
+}
+
+// orderByForeignKeys sorts specs so every table comes after the synced tables it
+// references. Ties keep the order of specs. A reference cycle is an error, since no
+// order could then load the tables one by one. Self-references are ignored.
+func orderByForeignKeys(specs []tableSpec, fks []foreignKey) ([]tableSpec, error) {
+	pos := map[string]int{}
+	for i, s := range specs {
+		pos[s.Name] = i
+	}
+
+	parents := map[string]map[string]bool{} // child -> synced parents
+	for _, fk := range fks {
+		_, childSynced := pos[fk.Child]
+		_, parentSynced := pos[fk.Parent]
+		if !childSynced || !parentSynced || fk.Child == fk.Parent {
+			continue
+		}
+		if parents[fk.Child] == nil {
+			parents[fk.Child] = map[string]bool{}
+		}
+		parents[fk.Child][fk.Parent] = true
+	}
+
+	// Kahn's algorithm, always taking the earliest ready table in spec order
+	var out []tableSpec
+	done := map[string]bool{}
+	for len(out) < len(specs) {
+		next := -1
+		for i, s := range specs {
+			if done[s.Name] {
+				continue
+			}
+			ready := true
+			for p := range parents[s.Name] {
+				if !done[p] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("foreign key cycle: %s", strings.Join(findCycle(specs, parents, done), " -> "))
+		}
+		done[specs[next].Name] = true
+		out = append(out, specs[next])
+	}
+	return out, nil
+}
+
+// findCycle walks from a table that could not be ordered to one of its unordered
+// parents until a table repeats; every such table is blocked by a cycle.
+func findCycle(specs []tableSpec, parents map[string]map[string]bool, done map[string]bool) []string {
+	var cur string
+	for _, s := range specs {
+		if !done[s.Name] {
+			cur = s.Name
+			break
+		}
+	}
+	seenAt := map[string]int{}
+	var path []string
+	for {
+		if i, seen := seenAt[cur]; seen {
+			return append(path[i:], cur)
+		}
+		seenAt[cur] = len(path)
+		path = append(path, cur)
+		var ps []string
+		for p := range parents[cur] {
+			if !done[p] {
+				ps = append(ps, p)
+			}
+		}
+		sort.Strings(ps)
+		cur = ps[0]
+	}
+}
+
+// orphanReport describes source rows whose foreign key points at nothing.
+type orphanReport struct {
+	FK      foreignKey
+	Missing []string // referenced keys that exist neither in the source nor the destination
+}
+
+func (o orphanReport) String() string {
+	sample := o.Missing
+	if len(sample) > 10 {
+		sample = sample[:10]
+	}
+	return fmt.Sprintf("%s(%s) -> %s(%s): %d missing keys, e.g. %s",
+		o.FK.Child, strings.Join(o.FK.ChildColumns, ", "),
+		o.FK.Parent, strings.Join(o.FK.ParentColumns, ", "),
+		len(o.Missing), strings.Join(sample, " "))
+}
+
+// findOrphans checks, before anything is copied, that every foreign key value in the
+// rows about to be copied (the same watermark delta syncTable copies) will have its parent
+// in the destination: either the parent is already there, or it is among the rows about
+// to be copied from a synced parent table. Only the referenced keys are read; the parents
+// are looked up with NOT EXISTS on each side, never read in full.
+func findOrphans(ctx context.Context, src, dst *sqlx.DB, specs []tableSpec, fks []foreignKey, opts syncOptions) ([]orphanReport, error) {
+	byName := map[string]tableSpec{}
+	for _, s := range specs {
+		byName[s.Name] = s
+	}
+
+	var reports []orphanReport
+	for _, fk := range fks {
+		child, ok := byName[fk.Child]
+		if !ok || fk.Child == fk.Parent {
+			continue
+		}
+		childCols, ok := child.sourceColumnsFor(fk.ChildColumns)
+		if !ok {
+			continue // the key is not copied, so the destination fills it in
+		}
+
+		wm, since, err := copyFilter(ctx, dst, child, opts)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := distinctKeys(ctx, src, child.sourceTable(), childCols, wm, since)
+		if err != nil {
+			return nil, fmt.Errorf("read %s keys: %w", fk.Child, err)
+		}
+		if len(refs) == 0 {
+			continue
+		}
+
+		missing, err := missingKeys(ctx, dst, fk.Parent, fk.ParentColumns, refs, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("look up destination %s keys: %w", fk.Parent, err)
+		}
+		if parent, ok := byName[fk.Parent]; ok && len(missing) > 0 {
+			if parentCols, ok := parent.sourceColumnsFor(fk.ParentColumns); ok {
+				wm, since, err := copyFilter(ctx, dst, parent, opts)
+				if err != nil {
+					return nil, err
+				}
+				if missing, err = missingKeys(ctx, src, parent.sourceTable(), parentCols, missing, wm, since); err != nil {
+					return nil, fmt.Errorf("look up source %s keys: %w", fk.Parent, err)
+				}
+			}
+		}
+
+		if len(missing) > 0 {
+			rendered := make([]string, len(missing))
+			for i, k := range missing {
+				rendered[i] = renderKey(k)
+			}
+			sort.Strings(rendered)
+			reports = append(reports, orphanReport{FK: fk, Missing: rendered})
+		}
+	}
+	return reports, nil
+}
+
+// copyFilter is the source watermark column and lower bound syncTable will copy spec's
+// rows with, or "" and nil when it copies them all.
+func copyFilter(ctx context.Context, dst *sqlx.DB, spec tableSpec, opts syncOptions) (string, *time.Time, error) {
+	if spec.Watermark == "" {
+		return "", nil, nil
+	}
+	cols, ok := spec.sourceColumnsFor([]string{spec.Watermark})
+	if !ok {
+		return "", nil, fmt.Errorf("%s: watermark column %s is not synced", spec.Name, spec.Watermark)
+	}
+	since, err := deltaSince(ctx, dst, spec.Name, opts)
+	if err != nil || since == nil {
+		return "", nil, err
+	}
+	return cols[0], since, nil
+}
+
+// sourceColumnsFor maps destination columns of spec to the source columns they are read from.
+func (spec tableSpec) sourceColumnsFor(cols []string) ([]string, bool) {
+	srcCols := spec.sourceColumns()
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		found := false
+		for j, sc := range spec.Columns {
+			if sc == c {
+				out[i] = srcCols[j]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// distinctKeys returns the distinct non-NULL values of cols in table, limited to rows with
+// wm >= since when wm is set.
+func distinctKeys(ctx context.Context, db *sqlx.DB, table string, cols []string, wm string, since *time.Time) ([][]interface{}, error) {
+	conds := make([]string, len(cols))
+	for i, c := range cols {
+		conds[i] = pq.QuoteIdentifier(c) + " IS NOT NULL"
+	}
+	var args []interface{}
+	if wm != "" {
+		conds = append(conds, pq.QuoteIdentifier(wm)+" >= $1")
+		args = append(args, *since)
+	}
+	q := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s",
+		quoteIdents(cols), pq.QuoteIdentifier(table), strings.Join(conds, " AND "))
+
+	rows, err := db.QueryxContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys [][]interface{}
+	for rows.Next() {
+		k, err := rows.SliceScan()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range k {
+			if b, ok := v.([]byte); ok {
+				k[i] = string(b)
+			}
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// missingKeys returns the keys that have no row in table (matching cols, and wm >= since
+// when wm is set). The keys are copied into a temp table typed like table's columns, so
+// the lookup is a NOT EXISTS join that can use table's indexes. It reads only.
+func missingKeys(ctx context.Context, db *sqlx.DB, table string, cols []string, keys [][]interface{}, wm string, since *time.Time) ([][]interface{}, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const temp = "orphan_check_keys"
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+		temp, quoteIdents(cols), pq.QuoteIdentifier(table))); err != nil {
+		return nil, err
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(temp, cols...))
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if _, err := stmt.ExecContext(ctx, k...); err != nil {
+			stmt.Close()
+			return nil, err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	if err := stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	conds := make([]string, len(cols))
+	for i, c := range cols {
+		c = pq.QuoteIdentifier(c)
+		conds[i] = fmt.Sprintf("p.%s = k.%s", c, c)
+	}
+	var args []interface{}
+	if wm != "" {
+		conds = append(conds, "p."+pq.QuoteIdentifier(wm)+" >= $1")
+		args = append(args, *since)
+	}
+	rows, err := tx.QueryxContext(ctx, fmt.Sprintf("SELECT k.* FROM %s k WHERE NOT EXISTS (SELECT 1 FROM %s p WHERE %s)",
+		temp, pq.QuoteIdentifier(table), strings.Join(conds, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var missing [][]interface{}
+	for rows.Next() {
+		k, err := rows.SliceScan()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range k {
+			if b, ok := v.([]byte); ok {
+				k[i] = string(b)
+			}
+		}
+		missing = append(missing, k)
+	}
+	return missing, rows.Err()
+}
+
+// renderKey prints a key like a row literal: (1) or (1,two-sum).
+func renderKey(k []interface{}) string {
+	parts := make([]string, len(k))
+	for i, v := range k {
+		parts[i] = fmt.Sprint(v)
+	}
+	return "(" + strings.Join(parts, ",") + ")"
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderByForeignKeys(t *testing.T) {
+	specs := func(names ...string) []tableSpec {
+		out := make([]tableSpec, len(names))
+		for i, n := range names {
+			out[i] = tableSpec{Name: n}
+		}
+		return out
+	}
+	fk := func(child, parent string) foreignKey { return foreignKey{Child: child, Parent: parent} }
+
+	tests := []struct {
+		name    string
+		specs   []tableSpec
+		fks     []foreignKey
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "no keys keeps spec order",
+			specs: specs("b", "a", "c"),
+			want:  []string{"b", "a", "c"},
+		},
+		{
+			name:  "parents first",
+			specs: specs("company_problems", "problem_tags", "problems", "companies"),
+			fks:   []foreignKey{fk("company_problems", "problems"), fk("company_problems", "companies"), fk("problem_tags", "problems")},
+			want:  []string{"problems", "problem_tags", "companies", "company_problems"},
+		},
+		{
+			name:  "unsynced parents and self-references are ignored",
+			specs: specs("problem_relations", "problems"),
+			fks:   []foreignKey{fk("problem_relations", "problems"), fk("problems", "problems"), fk("problems", "users")},
+			want:  []string{"problems", "problem_relations"},
+		},
+		{
+			name:    "cycle",
+			specs:   specs("a", "b", "c", "d"),
+			fks:     []foreignKey{fk("a", "b"), fk("b", "c"), fk("c", "b"), fk("d", "a")},
+			wantErr: "foreign key cycle: b -> c -> b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderByForeignKeys(tt.specs, tt.fks)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("orderByForeignKeys: %v", err)
+			}
+			var names []string
+			for _, s := range got {
+				names = append(names, s.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("order = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderKey(t *testing.T) {
+	if got := renderKey([]interface{}{int64(1), "two-sum"}); got != "(1,two-sum)" {
+		t.Errorf("renderKey = %q", got)
+	}
+}
@@ -0,0 +1,962 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// graphqlSchema mirrors the dataset tables. Lists are relay-style connections with
+// opaque cursors; nested fields are loaded per sibling set (see problemBatch), so a page
+// of problems costs one query per nested field, not one per problem.
+const graphqlSchema = `
+scalar Time
+
+schema {
+  query: Query
+}
+
+type Query {
+  companies(filter: CompanyFilter, orderBy: CompanyOrder = NAME_ASC, first: Int = 50, after: String): CompanyConnection!
+  company(id: Int, name: String): Company
+  problems(filter: ProblemFilter, orderBy: ProblemOrder = ID_ASC, first: Int = 50, after: String): ProblemConnection!
+  problem(id: Int!): Problem
+  tags: [Tag!]!
+}
+
+input CompanyFilter {
+  nameContains: String
+}
+
+enum CompanyOrder {
+  NAME_ASC
+  PROBLEM_COUNT_DESC
+}
+
+input ProblemFilter {
+  difficulty: String
+  # problems must have every one of these tags (case-insensitive)
+  tags: [String!]
+  titleContains: String
+  # under a company: that company's timeframe; elsewhere: any company's
+  timeframe: String
+}
+
+enum ProblemOrder {
+  ID_ASC
+  ID_DESC
+  TITLE_ASC
+  # under a company: that company's frequency; elsewhere: problems.frequency
+  FREQUENCY_DESC
+  ACCEPTANCE_ASC
+  ACCEPTANCE_DESC
+  # asked by the most companies, recently and frequently
+  POPULARITY_DESC
+}
+
+type Company {
+  id: Int!
+  name: String!
+  problemCount: Int!
+  problems(filter: ProblemFilter, orderBy: ProblemOrder = FREQUENCY_DESC, first: Int = 50, after: String): CompanyProblemConnection!
+}
+
+type Problem {
+  id: Int!
+  url: String
+  title: String
+  difficulty: String
+  acceptance: Float
+  frequency: Float
+  popularity: Float
+  updatedAt: Time!
+  tags: [String!]!
+  companies: [CompanyProblem!]!
+  related: [Problem!]!
+}
+
+type CompanyProblem {
+  company: Company!
+  problem: Problem!
+  timeframeTag: String
+  sourceFile: String
+  # this company's frequency for the problem
+  frequency: Float
+  lastSeen: Time!
+}
+
+type Tag {
+  name: String!
+  problemCount: Int!
+  problems(orderBy: ProblemOrder = ID_ASC, first: Int = 50, after: String): ProblemConnection!
+}
+
+type PageInfo {
+  hasNextPage: Boolean!
+  endCursor: String
+}
+
+type CompanyConnection {
+  totalCount: Int!
+  pageInfo: PageInfo!
+  edges: [CompanyEdge!]!
+}
+
+type CompanyEdge {
+  cursor: String!
+  node: Company!
+}
+
+type ProblemConnection {
+  totalCount: Int!
+  pageInfo: PageInfo!
+  edges: [ProblemEdge!]!
+}
+
+type ProblemEdge {
+  cursor: String!
+  node: Problem!
+}
+
+type CompanyProblemConnection {
+  totalCount: Int!
+  pageInfo: PageInfo!
+  edges: [CompanyProblemEdge!]!
+}
+
+type CompanyProblemEdge {
+  cursor: String!
+  node: CompanyProblem!
+}
+`
+
+// maxGraphQLDepth bounds nesting such as problem { related { related { ... } } }.
+const maxGraphQLDepth = 10
+
+// sortKeys is an order as ascending expressions over the columns of a page query; the
+// last one is unique, so (keys) > (a row's keys) is exactly the rows after that row.
+// Descending columns are negated and NULLs sorted last by a leading "IS NULL" key.
+type sortKeys []string
+
+var problemOrders = map[string]sortKeys{
+	"ID_ASC":          {"id"},
+	"ID_DESC":         {"-id"},
+	"TITLE_ASC":       {"title IS NULL", "coalesce(title, '')", "id"},
+	"FREQUENCY_DESC":  {"frequency IS NULL", "-coalesce(frequency, 0)", "id"},
+	"ACCEPTANCE_ASC":  {"acceptance IS NULL", "coalesce(acceptance, 0)", "id"},
+	"ACCEPTANCE_DESC": {"acceptance IS NULL", "-coalesce(acceptance, 0)", "id"},
+	"POPULARITY_DESC": {"popularity IS NULL", "-coalesce(popularity, 0)", "id"},
+}
+
+// companyProblemOrders are problemOrders under Company.problems, where frequency is
+// the company's own (cp_frequency).
+var companyProblemOrders = func() map[string]sortKeys {
+	orders := map[string]sortKeys{}
+	for name, keys := range problemOrders {
+		orders[name] = keys
+	}
+	orders["FREQUENCY_DESC"] = sortKeys{"cp_frequency IS NULL", "-coalesce(cp_frequency, 0)", "id"}
+	return orders
+}()
+
+var companyOrders = map[string]sortKeys{
+	"NAME_ASC":           {"name", "id"},
+	"PROBLEM_COUNT_DESC": {"-problem_count", "name", "id"},
+}
+
+func newGraphQLSchema(db *sqlx.DB) *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema, &gqlResolver{db: db}, graphql.MaxDepth(maxGraphQLDepth))
+}
+
+// argument types
+
+type companyFilter struct {
+	NameContains *string
+}
+
+type problemFilter struct {
+	Difficulty    *string
+	Tags          *[]string
+	TitleContains *string
+	Timeframe     *string
+}
+
+// pageArgs are the connection arguments; first always has its schema default.
+type pageArgs struct {
+	First int32
+	After *string
+}
+
+type problemListArgs struct {
+	Filter  *problemFilter
+	OrderBy string
+	pageArgs
+}
+
+// sqlArgs collects query parameters; add returns the placeholder of the value.
+type sqlArgs []interface{}
+
+func (a *sqlArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// problemFilterSQL renders f as conditions on problems p (and company_problems cp when
+// companyScoped).
+func problemFilterSQL(f *problemFilter, a *sqlArgs, companyScoped bool) []string {
+	if f == nil {
+		return nil
+	}
+	var conds []string
+	if f.Difficulty != nil {
+		conds = append(conds, "lower(p.difficulty) = lower("+a.add(*f.Difficulty)+"::text)")
+	}
+	if f.TitleContains != nil {
+		conds = append(conds, "p.title ILIKE '%' || "+a.add(likeEscape(*f.TitleContains))+"::text || '%'")
+	}
+	if f.Tags != nil && len(*f.Tags) > 0 {
+		seen := map[string]bool{}
+		tags := []string{}
+		for _, t := range *f.Tags {
+			if t = strings.ToLower(t); !seen[t] {
+				seen[t] = true
+				tags = append(tags, t)
+			}
+		}
+		conds = append(conds, fmt.Sprintf(`p.id IN (
+			SELECT problem_id FROM problem_tags WHERE lower(tag) = ANY(%s)
+			GROUP BY problem_id HAVING count(DISTINCT lower(tag)) = %s)`,
+			a.add(pq.Array(tags)), a.add(len(tags))))
+	}
+	if f.Timeframe != nil {
+		if companyScoped {
+			conds = append(conds, "cp.timeframe_tag = "+a.add(*f.Timeframe))
+		} else {
+			conds = append(conds, "EXISTS (SELECT 1 FROM company_problems x WHERE x.problem_id = p.id AND x.timeframe_tag = "+a.add(*f.Timeframe)+")")
+		}
+	}
+	return conds
+}
+
+// likeEscape escapes the LIKE wildcards in s.
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func whereSQL(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(conds, " AND ")
+}
+
+// pagination
+
+// page is the first rows of an order after a cursor (all rows when after is nil).
+type page struct {
+	first int
+	order string
+	keys  sortKeys
+	after []string // sort key values of the cursor's row
+}
+
+// page decodes the connection arguments for the named order of orders.
+func (a pageArgs) page(order string, orders map[string]sortKeys) (page, error) {
+	if a.First < 0 {
+		return page{}, fmt.Errorf("first must not be negative")
+	}
+	pg := page{first: min(int(a.First), maxPageSize), order: order, keys: orders[order]}
+	if a.After != nil {
+		c, err := decodeCursor(*a.After)
+		if err != nil {
+			return pg, err
+		}
+		if c.Order != order || len(c.Keys) != len(pg.keys) {
+			return pg, fmt.Errorf("cursor %q is not for order %s", *a.After, order)
+		}
+		pg.after = c.Keys
+	}
+	return pg, nil
+}
+
+// cursor is a row's position in an order: the order and the row's sort key values, as
+// text. It stays valid when rows are inserted or deleted before it.
+type cursor struct {
+	Order string   `json:"o"`
+	Keys  []string `json:"k"`
+}
+
+// Cursors are kept opaque to clients.
+func encodeCursor(order string, keys []string) string {
+	b, _ := json.Marshal(cursor{Order: order, Keys: keys})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil || c.Order == "" || len(c.Keys) == 0 {
+		return cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	return c, nil
+}
+
+// pagedSQL keeps the rows of inner after pg's cursor, numbers them in order (per
+// partition, if given) and keeps first plus one to detect a next page. Each row gets
+// its sort key values as sort_key for its cursor. The cursor values are added to a.
+func pagedSQL(inner, partition string, pg page, a *sqlArgs) string {
+	order := strings.Join(pg.keys, ", ")
+	over, outer := "ORDER BY "+order, "rn"
+	if partition != "" {
+		over = "PARTITION BY " + partition + " " + over
+		outer = partition + ", rn"
+	}
+	keyText := make([]string, len(pg.keys))
+	for i, k := range pg.keys {
+		keyText[i] = "(" + k + ")::text"
+	}
+	where := ""
+	if pg.after != nil {
+		params := make([]string, len(pg.after))
+		for i, v := range pg.after {
+			params[i] = a.add(v)
+		}
+		where = fmt.Sprintf("WHERE (%s) > (%s)", order, strings.Join(params, ", "))
+	}
+	return fmt.Sprintf(`
+		SELECT * FROM (
+		  SELECT q.*, ARRAY[%s] AS sort_key, row_number() OVER (%s) AS rn
+		  FROM (%s) q
+		  %s
+		) n
+		WHERE rn <= %d
+		ORDER BY %s`, strings.Join(keyText, ", "), over, inner, where, pg.first+1, outer)
+}
+
+// countSQL counts the rows of inner (per partition, as total, if given).
+func countSQL(inner, partition string) string {
+	if partition == "" {
+		return "SELECT count(*) FROM (" + inner + ") q"
+	}
+	return fmt.Sprintf("SELECT %s, count(*) AS total FROM (%s) q GROUP BY %s", partition, inner, partition)
+}
+
+// pageMeta is the numbering pagedSQL adds to each row.
+type pageMeta struct {
+	Rn      int64          `db:"rn"`
+	SortKey pq.StringArray `db:"sort_key"`
+}
+
+func (m pageMeta) meta() pageMeta { return m }
+
+type pagedRow interface{ meta() pageMeta }
+
+// splitPage keeps the rows inside pg, reports whether more rows follow and returns the
+// cursors of the kept rows.
+func splitPage[T pagedRow](rows []T, pg page) (nodes []T, cursors []string, hasNext bool) {
+	for _, r := range rows {
+		m := r.meta()
+		if m.Rn > int64(pg.first) {
+			hasNext = true
+			continue
+		}
+		nodes = append(nodes, r)
+		cursors = append(cursors, encodeCursor(pg.order, m.SortKey))
+	}
+	return nodes, cursors, hasNext
+}
+
+type pageInfoResolver struct {
+	hasNext bool
+	end     *string
+}
+
+func (p *pageInfoResolver) HasNextPage() bool  { return p.hasNext }
+func (p *pageInfoResolver) EndCursor() *string { return p.end }
+
+func newPageInfo(hasNext bool, cursors []string) *pageInfoResolver {
+	info := &pageInfoResolver{hasNext: hasNext}
+	if len(cursors) > 0 {
+		info.end = &cursors[len(cursors)-1]
+	}
+	return info
+}
+
+// root resolver
+
+type gqlResolver struct {
+	db *sqlx.DB
+}
+
+type companyRow struct {
+	apiCompany
+	pageMeta
+}
+
+func (q *gqlResolver) Companies(ctx context.Context, args struct {
+	Filter  *companyFilter
+	OrderBy string
+	pageArgs
+}) (*companyConnection, error) {
+	pg, err := args.page(args.OrderBy, companyOrders)
+	if err != nil {
+		return nil, err
+	}
+	var a sqlArgs
+	where := ""
+	if args.Filter != nil && args.Filter.NameContains != nil {
+		where = " WHERE c.name ILIKE '%' || " + a.add(likeEscape(*args.Filter.NameContains)) + "::text || '%'"
+	}
+	inner := `SELECT c.id, c.name,
+	            (SELECT count(*) FROM company_problems cp WHERE cp.company_id = c.id) AS problem_count
+	          FROM companies c` + where
+
+	var total int64
+	if err := q.db.GetContext(ctx, &total, countSQL(inner, ""), a...); err != nil {
+		return nil, err
+	}
+	var rows []companyRow
+	if err := q.db.SelectContext(ctx, &rows, pagedSQL(inner, "", pg, &a), a...); err != nil {
+		return nil, err
+	}
+	nodes, cursors, hasNext := splitPage(rows, pg)
+
+	batch := &companyBatch{db: q.db}
+	conn := &companyConnection{total: total, edges: []*companyEdge{}}
+	for i, r := range nodes {
+		cr := batch.resolver(exportCompany{ID: r.ID, Name: r.Name})
+		cr.count = &r.ProblemCount
+		conn.edges = append(conn.edges, &companyEdge{cursor: cursors[i], node: cr})
+	}
+	conn.info = newPageInfo(hasNext, cursors)
+	return conn, nil
+}
+
+func (q *gqlResolver) Company(ctx context.Context, args struct {
+	ID   *int32
+	Name *string
+}) (*companyResolver, error) {
+	if (args.ID == nil) == (args.Name == nil) {
+		return nil, fmt.Errorf("company needs exactly one of id or name")
+	}
+	var cs []exportCompany
+	var err error
+	if args.ID != nil {
+		err = q.db.SelectContext(ctx, &cs, "SELECT id, name FROM companies WHERE id = $1", *args.ID)
+	} else {
+		err = q.db.SelectContext(ctx, &cs, "SELECT id, name FROM companies WHERE lower(name) = lower($1)", *args.Name)
+	}
+	if err != nil || len(cs) == 0 {
+		return nil, err
+	}
+	return (&companyBatch{db: q.db}).resolver(cs[0]), nil
+}
+
+type problemRow struct {
+	exportProblem
+	pageMeta
+}
+
+func (q *gqlResolver) Problems(ctx context.Context, args problemListArgs) (*problemConnection, error) {
+	return problemsConnection(ctx, q.db, args)
+}
+
+// problemsConnection pages through all problems matching args.
+func problemsConnection(ctx context.Context, db *sqlx.DB, args problemListArgs) (*problemConnection, error) {
+	pg, err := args.page(args.OrderBy, problemOrders)
+	if err != nil {
+		return nil, err
+	}
+	var a sqlArgs
+	conds := problemFilterSQL(args.Filter, &a, false)
+	inner := "SELECT p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at FROM problems p WHERE true" + whereSQL(conds)
+
+	var total int64
+	if err := db.GetContext(ctx, &total, countSQL(inner, ""), a...); err != nil {
+		return nil, err
+	}
+	var rows []problemRow
+	if err := db.SelectContext(ctx, &rows, pagedSQL(inner, "", pg, &a), a...); err != nil {
+		return nil, err
+	}
+	nodes, cursors, hasNext := splitPage(rows, pg)
+
+	problems := make([]exportProblem, len(nodes))
+	for i, r := range nodes {
+		problems[i] = r.exportProblem
+	}
+	resolvers := newProblemBatch(db, problems)
+
+	conn := &problemConnection{total: total, edges: []*problemEdge{}}
+	for i := range nodes {
+		conn.edges = append(conn.edges, &problemEdge{cursor: cursors[i], node: resolvers[i]})
+	}
+	conn.info = newPageInfo(hasNext, cursors)
+	return conn, nil
+}
+
+func (q *gqlResolver) Problem(ctx context.Context, args struct{ ID int32 }) (*problemResolver, error) {
+	var ps []exportProblem
+	err := q.db.SelectContext(ctx, &ps, `
+		SELECT id, url, title, difficulty, acceptance, frequency, popularity, updated_at
+		FROM problems WHERE id = $1`, args.ID)
+	if err != nil || len(ps) == 0 {
+		return nil, err
+	}
+	return newProblemBatch(q.db, ps)[0], nil
+}
+
+func (q *gqlResolver) Tags(ctx context.Context) ([]*tagResolver, error) {
+	var tags []apiTag
+	if err := q.db.SelectContext(ctx, &tags, `
+		SELECT tag, count(*) AS problems
+		FROM problem_tags
+		GROUP BY tag
+		ORDER BY tag`); err != nil {
+		return nil, err
+	}
+	out := make([]*tagResolver, len(tags))
+	for i, t := range tags {
+		out[i] = &tagResolver{db: q.db, t: t}
+	}
+	return out, nil
+}
+
+// tags
+
+type tagResolver struct {
+	db *sqlx.DB
+	t  apiTag
+}
+
+func (t *tagResolver) Name() string        { return t.t.Tag }
+func (t *tagResolver) ProblemCount() int32 { return int32(t.t.Problems) }
+
+func (t *tagResolver) Problems(ctx context.Context, args struct {
+	OrderBy string
+	pageArgs
+}) (*problemConnection, error) {
+	tags := []string{t.t.Tag}
+	return problemsConnection(ctx, t.db, problemListArgs{
+		Filter:   &problemFilter{Tags: &tags},
+		OrderBy:  args.OrderBy,
+		pageArgs: args.pageArgs,
+	})
+}
+
+// problems
+
+// problemBatch is a set of sibling problems (one page, one related list, ...). The first
+// time any of them resolves a nested field, that field is loaded for the whole set.
+type problemBatch struct {
+	db        *sqlx.DB
+	resolvers []*problemResolver
+
+	tagsOnce sync.Once
+	tags     map[int64][]string
+	tagsErr  error
+
+	companiesOnce sync.Once
+	companies     map[int64][]*companyProblemResolver
+	companiesErr  error
+
+	relatedOnce sync.Once
+	related     map[int64][]*problemResolver
+	relatedErr  error
+}
+
+// newProblemBatch returns resolvers for problems that load their nested fields together.
+func newProblemBatch(db *sqlx.DB, problems []exportProblem) []*problemResolver {
+	b := &problemBatch{db: db}
+	for _, p := range problems {
+		b.resolvers = append(b.resolvers, &problemResolver{p: p, batch: b})
+	}
+	return b.resolvers
+}
+
+func (b *problemBatch) ids() pq.Int64Array {
+	ids := make(pq.Int64Array, len(b.resolvers))
+	for i, r := range b.resolvers {
+		ids[i] = r.p.ID
+	}
+	return ids
+}
+
+func (b *problemBatch) loadTags(ctx context.Context) {
+	var rows []struct {
+		ProblemID int64  `db:"problem_id"`
+		Tag       string `db:"tag"`
+	}
+	b.tagsErr = b.db.SelectContext(ctx, &rows, `
+		SELECT problem_id, tag FROM problem_tags
+		WHERE problem_id = ANY($1)
+		ORDER BY problem_id, tag`, b.ids())
+	b.tags = map[int64][]string{}
+	for _, r := range rows {
+		b.tags[r.ProblemID] = append(b.tags[r.ProblemID], r.Tag)
+	}
+}
+
+func (b *problemBatch) loadCompanies(ctx context.Context) {
+	var rows []struct {
+		exportCompanyProblem
+		Name string `db:"name"`
+	}
+	b.companiesErr = b.db.SelectContext(ctx, &rows, `
+		SELECT cp.company_id, cp.problem_id, cp.source_file, cp.timeframe_tag, cp.frequency, cp.last_seen, c.name
+		FROM company_problems cp
+		JOIN companies c ON c.id = cp.company_id
+		WHERE cp.problem_id = ANY($1)
+		ORDER BY cp.problem_id, c.name`, b.ids())
+
+	byID := map[int64]*problemResolver{}
+	for _, r := range b.resolvers {
+		byID[r.p.ID] = r
+	}
+	companies := &companyBatch{db: b.db}
+	b.companies = map[int64][]*companyProblemResolver{}
+	for _, r := range rows {
+		b.companies[r.ProblemID] = append(b.companies[r.ProblemID], &companyProblemResolver{
+			cp:      r.exportCompanyProblem,
+			company: companies.resolver(exportCompany{ID: r.CompanyID, Name: r.Name}),
+			problem: byID[r.ProblemID],
+		})
+	}
+}
+
+func (b *problemBatch) loadRelated(ctx context.Context) {
+	var rows []struct {
+		FromID int64 `db:"from_id"`
+		exportProblem
+	}
+	b.relatedErr = b.db.SelectContext(ctx, &rows, `
+		SELECT r.problem_id AS from_id,
+		       p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at
+		FROM problem_relations r
+		JOIN problems p ON p.id = r.related_id
+		WHERE r.problem_id = ANY($1)
+		ORDER BY r.problem_id, p.id`, b.ids())
+
+	// every related problem appears once in the next batch, whoever it is related to
+	index := map[int64]int{}
+	var unique []exportProblem
+	for _, r := range rows {
+		if _, ok := index[r.ID]; !ok {
+			index[r.ID] = len(unique)
+			unique = append(unique, r.exportProblem)
+		}
+	}
+	next := newProblemBatch(b.db, unique)
+	b.related = map[int64][]*problemResolver{}
+	for _, r := range rows {
+		b.related[r.FromID] = append(b.related[r.FromID], next[index[r.ID]])
+	}
+}
+
+type problemResolver struct {
+	p     exportProblem
+	batch *problemBatch
+}
+
+func (r *problemResolver) ID() int32               { return int32(r.p.ID) }
+func (r *problemResolver) URL() *string            { return r.p.URL }
+func (r *problemResolver) Title() *string          { return r.p.Title }
+func (r *problemResolver) Difficulty() *string     { return r.p.Difficulty }
+func (r *problemResolver) Acceptance() *float64    { return r.p.Acceptance }
+func (r *problemResolver) Frequency() *float64     { return r.p.Frequency }
+func (r *problemResolver) Popularity() *float64    { return r.p.Popularity }
+func (r *problemResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.p.UpdatedAt} }
+
+func (r *problemResolver) Tags(ctx context.Context) ([]string, error) {
+	r.batch.tagsOnce.Do(func() { r.batch.loadTags(ctx) })
+	return nonNil(r.batch.tags[r.p.ID]), r.batch.tagsErr
+}
+
+func (r *problemResolver) Companies(ctx context.Context) ([]*companyProblemResolver, error) {
+	r.batch.companiesOnce.Do(func() { r.batch.loadCompanies(ctx) })
+	if cs := r.batch.companies[r.p.ID]; cs != nil {
+		return cs, nil
+	}
+	return []*companyProblemResolver{}, r.batch.companiesErr
+}
+
+func (r *problemResolver) Related(ctx context.Context) ([]*problemResolver, error) {
+	r.batch.relatedOnce.Do(func() { r.batch.loadRelated(ctx) })
+	if rs := r.batch.related[r.p.ID]; rs != nil {
+		return rs, nil
+	}
+	return []*problemResolver{}, r.batch.relatedErr
+}
+
+// companies
+
+// companyBatch is a set of sibling companies whose problem counts and problem pages are
+// loaded together, one query per distinct set of arguments.
+type companyBatch struct {
+	db        *sqlx.DB
+	resolvers []*companyResolver
+	byID      map[int64]*companyResolver
+
+	countOnce sync.Once
+	counts    map[int64]int64
+	countErr  error
+
+	mu       sync.Mutex
+	problems map[string]*companyProblemsLoad
+}
+
+type companyProblemsLoad struct {
+	once  sync.Once
+	conns map[int64]*companyProblemConnection
+	err   error
+}
+
+// resolver returns the batch's resolver for c, adding it on first use.
+func (b *companyBatch) resolver(c exportCompany) *companyResolver {
+	if r, ok := b.byID[c.ID]; ok {
+		return r
+	}
+	if b.byID == nil {
+		b.byID = map[int64]*companyResolver{}
+	}
+	r := &companyResolver{c: c, batch: b}
+	b.byID[c.ID] = r
+	b.resolvers = append(b.resolvers, r)
+	return r
+}
+
+func (b *companyBatch) ids() pq.Int64Array {
+	ids := make(pq.Int64Array, len(b.resolvers))
+	for i, r := range b.resolvers {
+		ids[i] = r.c.ID
+	}
+	return ids
+}
+
+func (b *companyBatch) loadCounts(ctx context.Context) {
+	var rows []struct {
+		CompanyID int64 `db:"company_id"`
+		Count     int64 `db:"count"`
+	}
+	b.countErr = b.db.SelectContext(ctx, &rows, `
+		SELECT company_id, count(*) AS count FROM company_problems
+		WHERE company_id = ANY($1)
+		GROUP BY company_id`, b.ids())
+	b.counts = map[int64]int64{}
+	for _, r := range rows {
+		b.counts[r.CompanyID] = r.Count
+	}
+}
+
+// companyProblemRow is a problem as asked by one company. problems and company_problems
+// both have a frequency column, so the company's is read as cp_frequency.
+type companyProblemRow struct {
+	exportProblem
+	CompanyID        int64     `db:"company_id"`
+	SourceFile       *string   `db:"source_file"`
+	TimeframeTag     *string   `db:"timeframe_tag"`
+	CompanyFrequency *float64  `db:"cp_frequency"`
+	LastSeen         time.Time `db:"last_seen"`
+	pageMeta
+}
+
+func (r companyProblemRow) companyProblem() exportCompanyProblem {
+	return exportCompanyProblem{
+		CompanyID:    r.CompanyID,
+		ProblemID:    r.ID,
+		SourceFile:   r.SourceFile,
+		TimeframeTag: r.TimeframeTag,
+		Frequency:    r.CompanyFrequency,
+		LastSeen:     r.LastSeen,
+	}
+}
+
+// loadProblems pages through the problems of every company in the batch at once.
+func (b *companyBatch) loadProblems(ctx context.Context, args problemListArgs) (map[int64]*companyProblemConnection, error) {
+	key, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	if b.problems == nil {
+		b.problems = map[string]*companyProblemsLoad{}
+	}
+	load, ok := b.problems[string(key)]
+	if !ok {
+		load = &companyProblemsLoad{}
+		b.problems[string(key)] = load
+	}
+	b.mu.Unlock()
+
+	load.once.Do(func() { load.conns, load.err = b.queryProblems(ctx, args) })
+	return load.conns, load.err
+}
+
+func (b *companyBatch) queryProblems(ctx context.Context, args problemListArgs) (map[int64]*companyProblemConnection, error) {
+	pg, err := args.page(args.OrderBy, companyProblemOrders)
+	if err != nil {
+		return nil, err
+	}
+	var a sqlArgs
+	companies := a.add(b.ids())
+	conds := problemFilterSQL(args.Filter, &a, true)
+	inner := `SELECT p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at,
+	                 cp.company_id, cp.source_file, cp.timeframe_tag, cp.frequency AS cp_frequency, cp.last_seen
+	          FROM company_problems cp
+	          JOIN problems p ON p.id = cp.problem_id
+	          WHERE cp.company_id = ANY(` + companies + ")" + whereSQL(conds)
+
+	var totals []struct {
+		CompanyID int64 `db:"company_id"`
+		Total     int64 `db:"total"`
+	}
+	if err := b.db.SelectContext(ctx, &totals, countSQL(inner, "company_id"), a...); err != nil {
+		return nil, err
+	}
+	var rows []companyProblemRow
+	if err := b.db.SelectContext(ctx, &rows, pagedSQL(inner, "company_id", pg, &a), a...); err != nil {
+		return nil, err
+	}
+	totalOf := map[int64]int64{}
+	for _, t := range totals {
+		totalOf[t.CompanyID] = t.Total
+	}
+
+	byCompany := map[int64][]companyProblemRow{}
+	for _, r := range rows {
+		byCompany[r.CompanyID] = append(byCompany[r.CompanyID], r)
+	}
+
+	// nested problem fields are batched across all companies' pages
+	var problems []exportProblem
+	var kept [][]companyProblemRow
+	var keptCursors [][]string
+	conns := map[int64]*companyProblemConnection{}
+	for _, c := range b.resolvers {
+		nodes, cursors, hasNext := splitPage(byCompany[c.c.ID], pg)
+		conns[c.c.ID] = &companyProblemConnection{total: totalOf[c.c.ID], info: newPageInfo(hasNext, cursors), edges: []*companyProblemEdge{}}
+		kept = append(kept, nodes)
+		keptCursors = append(keptCursors, cursors)
+		for _, n := range nodes {
+			problems = append(problems, n.exportProblem)
+		}
+	}
+	resolvers := newProblemBatch(b.db, problems)
+	i := 0
+	for ci, c := range b.resolvers {
+		conn := conns[c.c.ID]
+		for ni, n := range kept[ci] {
+			conn.edges = append(conn.edges, &companyProblemEdge{
+				cursor: keptCursors[ci][ni],
+				node:   &companyProblemResolver{cp: n.companyProblem(), company: c, problem: resolvers[i]},
+			})
+			i++
+		}
+	}
+	return conns, nil
+}
+
+type companyResolver struct {
+	c     exportCompany
+	count *int64 // known up front when listed by Query.companies
+	batch *companyBatch
+}
+
+func (r *companyResolver) ID() int32    { return int32(r.c.ID) }
+func (r *companyResolver) Name() string { return r.c.Name }
+
+func (r *companyResolver) ProblemCount(ctx context.Context) (int32, error) {
+	if r.count != nil {
+		return int32(*r.count), nil
+	}
+	r.batch.countOnce.Do(func() { r.batch.loadCounts(ctx) })
+	return int32(r.batch.counts[r.c.ID]), r.batch.countErr
+}
+
+func (r *companyResolver) Problems(ctx context.Context, args problemListArgs) (*companyProblemConnection, error) {
+	conns, err := r.batch.loadProblems(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return conns[r.c.ID], nil
+}
+
+type companyProblemResolver struct {
+	cp      exportCompanyProblem
+	company *companyResolver
+	problem *problemResolver
+}
+
+func (r *companyProblemResolver) Company() *companyResolver { return r.company }
+func (r *companyProblemResolver) Problem() *problemResolver { return r.problem }
+func (r *companyProblemResolver) TimeframeTag() *string     { return r.cp.TimeframeTag }
+func (r *companyProblemResolver) SourceFile() *string       { return r.cp.SourceFile }
+func (r *companyProblemResolver) Frequency() *float64       { return r.cp.Frequency }
+func (r *companyProblemResolver) LastSeen() graphql.Time    { return graphql.Time{Time: r.cp.LastSeen} }
+
+// connections
+
+type companyConnection struct {
+	total int64
+	info  *pageInfoResolver
+	edges []*companyEdge
+}
+
+func (c *companyConnection) TotalCount() int32           { return int32(c.total) }
+func (c *companyConnection) PageInfo() *pageInfoResolver { return c.info }
+func (c *companyConnection) Edges() []*companyEdge       { return c.edges }
+
+type companyEdge struct {
+	cursor string
+	node   *companyResolver
+}
+
+func (e *companyEdge) Cursor() string         { return e.cursor }
+func (e *companyEdge) Node() *companyResolver { return e.node }
+
+type problemConnection struct {
+	total int64
+	info  *pageInfoResolver
+	edges []*problemEdge
+}
+
+func (c *problemConnection) TotalCount() int32           { return int32(c.total) }
+func (c *problemConnection) PageInfo() *pageInfoResolver { return c.info }
+func (c *problemConnection) Edges() []*problemEdge       { return c.edges }
+
+type problemEdge struct {
+	cursor string
+	node   *problemResolver
+}
+
+func (e *problemEdge) Cursor() string         { return e.cursor }
+func (e *problemEdge) Node() *problemResolver { return e.node }
+
+type companyProblemConnection struct {
+	total int64
+	info  *pageInfoResolver
+	edges []*companyProblemEdge
+}
+
+func (c *companyProblemConnection) TotalCount() int32            { return int32(c.total) }
+func (c *companyProblemConnection) PageInfo() *pageInfoResolver  { return c.info }
+func (c *companyProblemConnection) Edges() []*companyProblemEdge { return c.edges }
+
+type companyProblemEdge struct {
+	cursor string
+	node   *companyProblemResolver
+}
+
+func (e *companyProblemEdge) Cursor() string                { return e.cursor }
+func (e *companyProblemEdge) Node() *companyProblemResolver { return e.node }
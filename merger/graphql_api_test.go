@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	c := encodeCursor("TITLE_ASC", []string{"false", "Two Sum", "1"})
+	got, err := decodeCursor(c)
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if want := (cursor{Order: "TITLE_ASC", Keys: []string{"false", "Two Sum", "1"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeCursor = %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"", "!!", "bzoxMA", encodeCursor("", []string{"1"}), encodeCursor("ID_ASC", nil)} {
+		if _, err := decodeCursor(bad); err == nil {
+			t.Errorf("decodeCursor(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPageArgs(t *testing.T) {
+	after := encodeCursor("ID_DESC", []string{"-15"})
+	tests := []struct {
+		name    string
+		args    pageArgs
+		order   string
+		want    []string
+		wantErr string
+	}{
+		{name: "first page", args: pageArgs{First: 10}, order: "ID_DESC"},
+		{name: "after", args: pageArgs{First: 10, After: &after}, order: "ID_DESC", want: []string{"-15"}},
+		{name: "other order", args: pageArgs{First: 10, After: &after}, order: "TITLE_ASC", wantErr: "not for order TITLE_ASC"},
+		{name: "negative first", args: pageArgs{First: -1}, order: "ID_ASC", wantErr: "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg, err := tt.args.page(tt.order, problemOrders)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("page: %v", err)
+			}
+			if !reflect.DeepEqual(pg.after, tt.want) {
+				t.Errorf("after = %v, want %v", pg.after, tt.want)
+			}
+		})
+	}
+}
+
+func TestPagedSQL(t *testing.T) {
+	a := sqlArgs{"Hard"}
+	pg := page{first: 20, order: "TITLE_ASC", keys: problemOrders["TITLE_ASC"], after: []string{"false", "Two Sum", "1"}}
+	got := pagedSQL("SELECT * FROM problems p WHERE difficulty = $1", "company_id", pg, &a)
+
+	for _, want := range []string{
+		"WHERE (title IS NULL, coalesce(title, ''), id) > ($2, $3, $4)",
+		"ARRAY[(title IS NULL)::text, (coalesce(title, ''))::text, (id)::text] AS sort_key",
+		"row_number() OVER (PARTITION BY company_id ORDER BY title IS NULL, coalesce(title, ''), id)",
+		"WHERE rn <= 21",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("query does not contain %q:\n%s", want, got)
+		}
+	}
+	if want := (sqlArgs{"Hard", "false", "Two Sum", "1"}); !reflect.DeepEqual(a, want) {
+		t.Errorf("args = %v, want %v", a, want)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphqlRequest is the JSON body of a GraphQL POST.
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// graphqlError is one entry of the "errors" array. Path starts with the alias
+// (q0, q1, ...) when the error belongs to a single aliased field.
+type graphqlError struct {
+	Message   string        `json:"message"`
+	Path      []interface{} `json:"path"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations"`
+}
+
+// alias returns the top-level field the error belongs to, or "" for request-wide errors.
+func (e graphqlError) alias() string {
+	if len(e.Path) == 0 {
+		return ""
+	}
+	s, _ := e.Path[0].(string)
+	return s
+}
+
+// GraphQL response dynamic mapping: keys are q0, q1, ...
+type questionEntry struct {
+	QuestionId         string `json:"questionId"`
+	QuestionFrontendId string `json:"questionFrontendId"`
+	TopicTags          []struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	} `json:"topicTags"`
+	// similarQuestions is returned by LeetCode as a JSON-encoded string, not as a list
+	SimilarQuestions string `json:"similarQuestions"`
+}
+
+// batchResponse holds one answer per alias; a nil entry means LeetCode returned null.
+type batchResponse struct {
+	Data   map[string]*questionEntry `json:"data"`
+	Errors []graphqlError            `json:"errors"`
+}
+
+// errorsByAlias groups the response errors by alias; request-wide errors are under "".
+func (br *batchResponse) errorsByAlias() map[string][]graphqlError {
+	out := map[string][]graphqlError{}
+	for _, e := range br.Errors {
+		out[e.alias()] = append(out[e.alias()], e)
+	}
+	return out
+}
+
+// graphqlClient posts queries to a LeetCode-compatible GraphQL endpoint.
+// The endpoint and http client are injectable so tests can run against a fake server.
+type graphqlClient struct {
+	endpoint string
+	http     *http.Client
+	retries  int           // retries after a 429 or 5xx answer
+	backoff  time.Duration // wait before the first retry, doubled for each next one
+}
+
+func newGraphQLClient(endpoint string, httpClient *http.Client) *graphqlClient {
+	if endpoint == "" {
+		endpoint = defaultGraphQLURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: time.Second * httpTimeoutSecs}
+	}
+	return &graphqlClient{endpoint: endpoint, http: httpClient, retries: graphqlRetries, backoff: graphqlBackoff}
+}
+
+// batchAlias is the alias of the idx-th problem in a batch; its slug is bound to $s<idx>.
+func batchAlias(idx int) string {
+	return fmt.Sprintf("q%d", idx)
+}
+
+// buildBatchQuery creates a query with aliases q0..qN, each reading its slug from
+// the matching $s0..$sN variable, so slugs never end up in the query text.
+func buildBatchQuery(batch []pslug) graphqlRequest {
+	vars := make(map[string]interface{}, len(batch))
+	params := make([]string, 0, len(batch))
+	var sb strings.Builder
+	for i, p := range batch {
+		v := fmt.Sprintf("s%d", i)
+		vars[v] = p.Slug
+		params = append(params, fmt.Sprintf("$%s: String!", v))
+		sb.WriteString(fmt.Sprintf("  %s: question(titleSlug: $%s) {\n", batchAlias(i), v))
+		sb.WriteString("    questionId\n")
+		sb.WriteString("    questionFrontendId\n")
+		sb.WriteString("    topicTags { name slug }\n")
+		sb.WriteString("    similarQuestions\n")
+		sb.WriteString("  }\n")
+	}
+	query := "query (" + strings.Join(params, ", ") + ") {\n" + sb.String() + "}\n"
+	return graphqlRequest{Query: query, Variables: vars}
+}
+
+// queryBatch fetches tags, ids and similar questions for every problem of the batch.
+func (c *graphqlClient) queryBatch(batch []pslug) (*batchResponse, error) {
+	var br batchResponse
+	if err := c.do(buildBatchQuery(batch), &br); err != nil {
+		return nil, err
+	}
+	return &br, nil
+}
+
+// do posts the request and decodes the JSON answer into out. 429 and 5xx answers are
+// retried with exponential backoff; transport errors (timeouts included) are not.
+func (c *graphqlClient) do(gq graphqlRequest, out interface{}) error {
+	bodyBytes, err := json.Marshal(gq)
+	if err != nil {
+		return err
+	}
+
+	wait := c.backoff
+	for attempt := 0; ; attempt++ {
+		respBytes, rs, err := c.post(bodyBytes)
+		if err != nil {
+			return err
+		}
+		if rs.status != 0 {
+			if attempt >= c.retries {
+				return fmt.Errorf("unexpected status %d after %d attempts", rs.status, attempt+1)
+			}
+			d := wait
+			if rs.wait > 0 {
+				d = rs.wait
+			}
+			log.Printf("GraphQL answered %d, retrying in %s", rs.status, d)
+			time.Sleep(d)
+			wait *= 2
+			continue
+		}
+		if err := json.Unmarshal(respBytes, out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		return nil
+	}
+}
+
+// retryableStatus is a 429 or 5xx answer, with the wait its Retry-After header asks for.
+type retryableStatus struct {
+	status int
+	wait   time.Duration
+}
+
+// post sends one request. It returns the body, or the status when the answer is worth
+// retrying.
+func (c *graphqlClient) post(body []byte) ([]byte, retryableStatus, error) {
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, retryableStatus{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// set user agent to avoid potential filtering
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; tag-sync/1.0)")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, retryableStatus{}, err
+	}
+	defer resp.Body.Close()
+
+	// Accept non-200 too (GraphQL commonly returns 200 even on errors); but retry 429 and 5xx
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		rs := retryableStatus{status: resp.StatusCode}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			rs.wait = time.Duration(secs) * time.Second
+		}
+		return nil, rs, nil
+	}
+
+	respBytes, err := ioReadAll(resp.Body)
+	return respBytes, retryableStatus{}, err
+}
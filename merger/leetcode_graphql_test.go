@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildBatchQuery(t *testing.T) {
+	batch := []pslug{{ID: 1, Slug: "two-sum"}, {ID: 15, Slug: `we"ird`}}
+	gq := buildBatchQuery(batch)
+
+	if want := map[string]interface{}{"s0": "two-sum", "s1": `we"ird`}; !reflect.DeepEqual(gq.Variables, want) {
+		t.Errorf("variables = %v, want %v", gq.Variables, want)
+	}
+	for _, want := range []string{"query ($s0: String!, $s1: String!)", "q0: question(titleSlug: $s0)", "q1: question(titleSlug: $s1)"} {
+		if !strings.Contains(gq.Query, want) {
+			t.Errorf("query does not contain %q:\n%s", want, gq.Query)
+		}
+	}
+	if strings.Contains(gq.Query, "two-sum") {
+		t.Errorf("slug leaked into the query text:\n%s", gq.Query)
+	}
+}
+
+func TestErrorsByAlias(t *testing.T) {
+	br := batchResponse{Errors: []graphqlError{
+		{Message: "rate limited"},
+		{Message: "no such question", Path: []interface{}{"q1"}},
+		{Message: "bad field", Path: []interface{}{"q1", "topicTags"}},
+		{Message: "odd path", Path: []interface{}{float64(0)}},
+	}}
+	got := br.errorsByAlias()
+
+	messages := func(errs []graphqlError) []string {
+		var out []string
+		for _, e := range errs {
+			out = append(out, e.Message)
+		}
+		return out
+	}
+	if want := []string{"rate limited", "odd path"}; !reflect.DeepEqual(messages(got[""]), want) {
+		t.Errorf(`errors[""] = %v, want %v`, messages(got[""]), want)
+	}
+	if want := []string{"no such question", "bad field"}; !reflect.DeepEqual(messages(got["q1"]), want) {
+		t.Errorf("errors[q1] = %v, want %v", messages(got["q1"]), want)
+	}
+	if len(got["q0"]) != 0 {
+		t.Errorf("errors[q0] = %v, want none", got["q0"])
+	}
+}
+
+func TestQueryBatch(t *testing.T) {
+	batch := []pslug{{ID: 1, Slug: "two-sum"}, {ID: 15, Slug: "3sum"}, {ID: 9999, Slug: "no-such-problem"}}
+
+	tests := []struct {
+		name    string
+		opts    fakeLeetCodeOptions
+		timeout time.Duration
+		retries int
+
+		wantErr      string
+		wantRequests int
+		wantData     []string // aliases with data
+		wantErrors   []string // aliases with errors
+	}{
+		{
+			name:         "ok",
+			wantRequests: 1,
+			wantData:     []string{"q0", "q1"},
+			wantErrors:   []string{"q2"},
+		},
+		{
+			name:         "429 then retried",
+			opts:         fakeLeetCodeOptions{RateLimitFirst: 2},
+			retries:      3,
+			wantRequests: 3,
+			wantData:     []string{"q0", "q1"},
+			wantErrors:   []string{"q2"},
+		},
+		{
+			name:         "429 past the retries",
+			opts:         fakeLeetCodeOptions{RateLimitFirst: 5},
+			retries:      2,
+			wantErr:      "unexpected status 429 after 3 attempts",
+			wantRequests: 3,
+		},
+		{
+			name:         "partial alias errors",
+			opts:         fakeLeetCodeOptions{ErrorSlugs: []string{"3sum"}},
+			wantRequests: 1,
+			wantData:     []string{"q0"},
+			wantErrors:   []string{"q1", "q2"},
+		},
+		{
+			name:         "timeout is not retried",
+			opts:         fakeLeetCodeOptions{Delay: 500 * time.Millisecond},
+			timeout:      50 * time.Millisecond,
+			retries:      3,
+			wantErr:      "Client.Timeout exceeded",
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.FixturesDir = "fixtures/leetcode"
+			srv := newFakeLeetCode(tt.opts)
+			defer srv.Close()
+
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 5 * time.Second
+			}
+			client := newGraphQLClient(srv.URL, &http.Client{Timeout: timeout})
+			client.retries, client.backoff = tt.retries, time.Millisecond
+
+			br, err := client.queryBatch(batch)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("queryBatch: %v", err)
+			}
+			if got := srv.Requests(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			if err != nil {
+				return
+			}
+
+			var data []string
+			for i := range batch {
+				if e := br.Data[batchAlias(i)]; e != nil && e.QuestionId != "" {
+					data = append(data, batchAlias(i))
+				}
+			}
+			if !reflect.DeepEqual(data, tt.wantData) {
+				t.Errorf("aliases with data = %v, want %v", data, tt.wantData)
+			}
+			var withErrors []string
+			byAlias := br.errorsByAlias()
+			for i := range batch {
+				if len(byAlias[batchAlias(i)]) > 0 {
+					withErrors = append(withErrors, batchAlias(i))
+				}
+			}
+			if !reflect.DeepEqual(withErrors, tt.wantErrors) {
+				t.Errorf("aliases with errors = %v, want %v", withErrors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestQueryBatchDecodesFixture(t *testing.T) {
+	srv := newFakeLeetCode(fakeLeetCodeOptions{FixturesDir: "fixtures/leetcode"})
+	defer srv.Close()
+
+	br, err := newGraphQLClient(srv.URL, nil).queryBatch([]pslug{{ID: 1, Slug: "two-sum"}})
+	if err != nil {
+		t.Fatalf("queryBatch: %v", err)
+	}
+	e := br.Data["q0"]
+	if e == nil || e.QuestionFrontendId != "1" || len(e.TopicTags) != 2 || e.TopicTags[1].Name != "Hash Table" {
+		t.Fatalf("q0 = %+v", e)
+	}
+	related, unknown := resolveSimilar(e.SimilarQuestions, map[string]int64{"3sum": 15})
+	if !reflect.DeepEqual(related, []int64{15}) || unknown != 1 {
+		t.Errorf("resolveSimilar = %v, %d unknown; want [15], 1 unknown", related, unknown)
+	}
+}
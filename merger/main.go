@@ -1,7 +1,60 @@
 package main
 
+import (
+	"log"
+	"os"
+)
+
+// Usage: go run . [command] [flags]
+//
+//	github   import the company-wise CSVs from ROOT_DIR into the local db
+//	tags     scrape topic tags and similar problems from leetcode.com
+//	sync     push the local db to supabase, or pull user progress (default)
+//	related  print the similar-problems neighborhood of a problem
+//	verify   compare row counts and content hashes between local and supabase
+//	export   write the local dataset to a versioned JSON/CSV/Parquet bundle
+//	sqlite   write the local db to an offline SQLite file, or import one back
+//	serve    serve the local db as a read-only JSON API
+//	search   search problems by title, slug and tags (typo tolerant)
+//	similar  compute and query company similarity and shared problems
+//	stats    refresh or print the per-company aggregates (company_stats)
+//	plan     write a day-by-day study plan for a set of target companies
+//	review   print a user's spaced-repetition reviews due by a date
 func main() {
-	// scrapeGithubMain()
-	// scrapeTagsMain()
-	supabaseSyncMain() // go run main.go supabase_sync.go
+	cmd := "sync"
+	var args []string
+	if len(os.Args) > 1 {
+		cmd, args = os.Args[1], os.Args[2:]
+	}
+
+	switch cmd {
+	case "github":
+		scrapeGithubMain()
+	case "tags":
+		scrapeTagsMain(args)
+	case "sync":
+		supabaseSyncMain(args)
+	case "related":
+		relatedMain(args)
+	case "verify":
+		verifyMain(args)
+	case "export":
+		exportMain(args)
+	case "sqlite":
+		sqliteMain(args)
+	case "serve":
+		serveMain(args)
+	case "search":
+		searchMain(args)
+	case "similar":
+		similarMain(args)
+	case "stats":
+		statsMain(args)
+	case "plan":
+		planMain(args)
+	case "review":
+		reviewMain(args)
+	default:
+		log.Fatalf("unknown command %q (want github, tags, sync, related, verify, export, sqlite, serve, search, similar, stats, plan or review)", cmd)
+	}
 }
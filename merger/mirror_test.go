@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckDeleteCap(t *testing.T) {
+	cascaded := map[string]int64{"problem_tags": 3, "company_problems": 2}
+	tests := []struct {
+		name     string
+		n        int64
+		cascaded map[string]int64
+		max      int
+		wantErr  string
+	}{
+		{name: "within the cap", n: 2, cascaded: cascaded, max: 7},
+		{name: "no limit", n: 5000, cascaded: cascaded, max: -1},
+		{name: "direct rows over", n: 3, max: 2, wantErr: "mirror would delete 3 rows from problems, more than -max-delete 2"},
+		{
+			name: "cascade pushes it over", n: 2, cascaded: cascaded, max: 6,
+			wantErr: "2 rows from problems and 5 more by cascade (company_problems 2, problem_tags 3), 7 in all, more than -max-delete 6",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDeleteCap("problems", tt.n, tt.cascaded, tt.max)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkDeleteCap: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMirrorDeletes(t *testing.T) {
+	db := testPostgres(t)
+	// problem 1 is still in the source; 2 and 3 are gone and take their children along
+	db.MustExec(`
+		INSERT INTO companies (id, name) VALUES (1, 'Google');
+		INSERT INTO problems (id) VALUES (1), (2), (3);
+		INSERT INTO company_problems (company_id, problem_id) VALUES (1, 1), (1, 2), (1, 3);
+		INSERT INTO problem_tags (problem_id, tag) VALUES (1, 'Array'), (2, 'Array'), (3, 'Graph'), (3, 'Tree');
+		INSERT INTO problem_relations (problem_id, related_id) VALUES (1, 2), (2, 3), (3, 1);
+		INSERT INTO user_progress (user_hash, problem_id) VALUES ('u1', 1), ('u1', 2);`)
+	wantCascaded := map[string]int64{"company_problems": 2, "problem_tags": 3, "problem_relations": 3, "user_progress": 1}
+
+	tests := []struct {
+		name         string
+		opts         syncOptions
+		wantN        int64
+		wantCascaded map[string]int64
+		wantErr      string
+		wantLeft     int // problems left afterwards
+	}{
+		{name: "not mirroring", opts: syncOptions{MaxDelete: -1}, wantLeft: 3},
+		{name: "dry run counts", opts: syncOptions{Mirror: true, DryRun: true, MaxDelete: -1}, wantN: 2, wantCascaded: wantCascaded, wantLeft: 3},
+		{
+			name: "cascade exceeds the cap", opts: syncOptions{Mirror: true, MaxDelete: 5},
+			wantN: 2, wantCascaded: wantCascaded, wantErr: "9 more by cascade", wantLeft: 3,
+		},
+		{name: "within the cap", opts: syncOptions{Mirror: true, MaxDelete: 11}, wantN: 2, wantCascaded: wantCascaded, wantLeft: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tx, err := db.BeginTxx(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			tx.MustExec("CREATE TEMP TABLE temp_problems ON COMMIT DROP AS SELECT id FROM problems WHERE id = 1")
+
+			n, cascaded, err := mirrorDeletes(ctx, tx, "problems", "temp_problems", []string{"id"}, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("mirrorDeletes: %v", err)
+			}
+			if n != tt.wantN {
+				t.Errorf("deleted = %d, want %d", n, tt.wantN)
+			}
+			if len(cascaded) > 0 || len(tt.wantCascaded) > 0 {
+				if !reflect.DeepEqual(cascaded, tt.wantCascaded) {
+					t.Errorf("cascaded = %v, want %v", cascaded, tt.wantCascaded)
+				}
+			}
+			var left int
+			if err := tx.Get(&left, "SELECT count(*) FROM problems"); err != nil {
+				t.Fatal(err)
+			}
+			if left != tt.wantLeft {
+				t.Errorf("%d problems left, want %d", left, tt.wantLeft)
+			}
+		})
+	}
+}
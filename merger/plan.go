@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// planMinutes is the time budgeted for a problem of each difficulty; unknown difficulties
+// count as Medium.
+var planMinutes = map[string]int{"Easy": 20, "Medium": 40, "Hard": 60}
+
+// planDifficultyMix is the share of each difficulty a plan aims for.
+var planDifficultyMix = map[string]float64{"Easy": 0.25, "Medium": 0.55, "Hard": 0.2}
+
+type planAsk struct {
+	Company   string   `json:"company"`
+	Timeframe *string  `json:"timeframe_tag"`
+	Frequency *float64 `json:"frequency"`
+}
+
+type planProblem struct {
+	exportProblem
+	Tags    pq.StringArray `db:"tags" json:"tags"`
+	AskedBy []planAsk      `db:"-" json:"asked_by"`
+	Minutes int            `db:"-" json:"minutes"`
+	// priority is what the problem is worth to the target companies: for each of them
+	// asking it, recency weight * (1 + frequency / 100) / 2, like problems.popularity.
+	priority float64
+}
+
+type planDay struct {
+	Day      int           `json:"day"`
+	Date     string        `json:"date"`
+	Minutes  int           `json:"minutes"`
+	Problems []planProblem `json:"problems"`
+}
+
+type studyPlan struct {
+	Companies    []string       `json:"companies"`
+	Days         int            `json:"days"`
+	Budget       int            `json:"budget_minutes"`
+	Candidates   int            `json:"candidates"`
+	Skipped      int            `json:"skipped_completed"`
+	Difficulties map[string]int `json:"difficulties"`
+	Tags         map[string]int `json:"tags"`
+	Schedule     []planDay      `json:"schedule"`
+}
+
+// loadPlanCandidates reads every problem asked by one of companyIDs, with the asks of those
+// companies. With a userHash it leaves out the problems that user completed (per the
+// pulled user_progress) and counts them; without one user_progress is not read at all.
+func loadPlanCandidates(ctx context.Context, db *sqlx.DB, companyIDs []int64, userHash string) ([]planProblem, int, error) {
+	ids := pq.Int64Array(companyIDs)
+	args := []interface{}{ids}
+	completed := ""
+	if userHash != "" {
+		completed = " AND p.id NOT IN (SELECT problem_id FROM user_progress WHERE user_hash = $2)"
+		args = append(args, userHash)
+	}
+	var problems []planProblem
+	if err := db.SelectContext(ctx, &problems, `
+		SELECT p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at,
+		       ARRAY(SELECT tag FROM problem_tags WHERE problem_id = p.id ORDER BY tag) AS tags
+		FROM problems p
+		WHERE p.id IN (SELECT problem_id FROM company_problems WHERE company_id = ANY($1))`+completed+`
+		ORDER BY p.id`, args...); err != nil {
+		return nil, 0, fmt.Errorf("problems: %w", err)
+	}
+
+	var skipped int
+	if userHash != "" {
+		if err := db.GetContext(ctx, &skipped, `
+			SELECT count(DISTINCT up.problem_id)
+			FROM user_progress up
+			JOIN company_problems cp ON cp.problem_id = up.problem_id
+			WHERE up.user_hash = $2 AND cp.company_id = ANY($1)`, ids, userHash); err != nil {
+			return nil, 0, fmt.Errorf("completed problems: %w", err)
+		}
+	}
+
+	var asks []struct {
+		ProblemID int64    `db:"problem_id"`
+		Company   string   `db:"name"`
+		Timeframe *string  `db:"timeframe_tag"`
+		Frequency *float64 `db:"frequency"`
+	}
+	if err := db.SelectContext(ctx, &asks, `
+		SELECT cp.problem_id, c.name, cp.timeframe_tag, cp.frequency
+		FROM company_problems cp
+		JOIN companies c ON c.id = cp.company_id
+		WHERE cp.company_id = ANY($1)
+		ORDER BY cp.problem_id, c.name`, ids); err != nil {
+		return nil, 0, fmt.Errorf("company problems: %w", err)
+	}
+
+	byID := make(map[int64]*planProblem, len(problems))
+	for i := range problems {
+		p := &problems[i]
+		p.Minutes = planMinutes["Medium"]
+		if m, ok := planMinutes[derefString(p.Difficulty)]; ok {
+			p.Minutes = m
+		}
+		byID[p.ID] = p
+	}
+	for _, a := range asks {
+		p, ok := byID[a.ProblemID]
+		if !ok {
+			continue // completed
+		}
+		p.AskedBy = append(p.AskedBy, planAsk{Company: a.Company, Timeframe: a.Timeframe, Frequency: a.Frequency})
+		freq := 0.0
+		if a.Frequency != nil {
+			freq = *a.Frequency
+		}
+		p.priority += recencyWeight(a.Timeframe) * (1 + freq/100) / 2
+	}
+	return problems, skipped, nil
+}
+
+// buildStudyPlan greedily picks problems into days days of budget minutes each. Every
+// pick takes the candidate with the best priority, scaled up for tags the plan does not
+// cover yet and for difficulties below their planDifficultyMix share, and goes into the
+// earliest day it fits. Days are then ordered easy to hard.
+func buildStudyPlan(candidates []planProblem, days, budget int, start time.Time) []planDay {
+	schedule := make([]planDay, days)
+	for i := range schedule {
+		schedule[i] = planDay{Day: i + 1, Date: start.AddDate(0, 0, i).Format("2006-01-02"), Problems: []planProblem{}}
+	}
+
+	tagCount := map[string]int{}
+	diffCount := map[string]int{}
+	picked := 0
+	used := make([]bool, len(candidates))
+	for {
+		room := 0
+		for _, d := range schedule {
+			if budget-d.Minutes > room {
+				room = budget - d.Minutes
+			}
+		}
+
+		best, bestScore := -1, 0.0
+		for i, c := range candidates {
+			if used[i] || c.Minutes > room {
+				continue
+			}
+			// average novelty of the problem's tags: 1 for an uncovered tag, 1/2 once covered, ...
+			novelty := 0.5
+			if len(c.Tags) > 0 {
+				novelty = 0
+				for _, t := range c.Tags {
+					novelty += 1 / float64(1+tagCount[t])
+				}
+				novelty /= float64(len(c.Tags))
+			}
+			balance := 1.0
+			if share, ok := planDifficultyMix[derefString(c.Difficulty)]; ok {
+				current := 0.0
+				if picked > 0 {
+					current = float64(diffCount[*c.Difficulty]) / float64(picked)
+				}
+				balance = min(max(1+share-current, 0.5), 1.5)
+			}
+			score := c.priority * (1 + novelty) * balance
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		c := candidates[best]
+		used[best] = true
+		picked++
+		diffCount[derefString(c.Difficulty)]++
+		for _, t := range c.Tags {
+			tagCount[t]++
+		}
+		for i := range schedule {
+			if schedule[i].Minutes+c.Minutes <= budget {
+				schedule[i].Minutes += c.Minutes
+				schedule[i].Problems = append(schedule[i].Problems, c)
+				break
+			}
+		}
+	}
+
+	for _, d := range schedule {
+		sort.SliceStable(d.Problems, func(i, j int) bool { return d.Problems[i].Minutes < d.Problems[j].Minutes })
+	}
+	return schedule
+}
+
+// planMain writes a day-by-day study plan for a set of target companies.
+// Usage: go run . plan -company google,amazon [-days 30] [-budget 60] [-user id] [-format markdown|json] [-out file]
+func planMain(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	companies := fs.String("company", "", "comma-separated target companies (required)")
+	days := fs.Int("days", 30, "days until the deadline")
+	budget := fs.Int("budget", 60, "minutes per day")
+	user := fs.String("user", "", "Supabase user id whose completed problems are skipped (needs USER_HASH_SALT and a pulled user_progress)")
+	format := fs.String("format", "markdown", "markdown or json")
+	out := fs.String("out", "", "file to write (default stdout)")
+	startDate := fs.String("start", time.Now().Format("2006-01-02"), "date of day 1 (YYYY-MM-DD)")
+	fs.Parse(args)
+
+	names := splitList(*companies)
+	if len(names) == 0 {
+		log.Fatalf("usage: plan -company a,b [flags]")
+	}
+	if *days < 1 || *budget < 1 {
+		log.Fatalf("-days and -budget must be positive")
+	}
+	if *format != "markdown" && *format != "json" {
+		log.Fatalf("unknown format %q (want markdown or json)", *format)
+	}
+	start, err := time.Parse("2006-01-02", *startDate)
+	if err != nil {
+		log.Fatalf("bad -start: %v", err)
+	}
+
+	godotenv.Load()
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+	var userHash string
+	if *user != "" {
+		salt := os.Getenv("USER_HASH_SALT")
+		if salt == "" {
+			log.Fatalf("USER_HASH_SALT environment variable is required with -user")
+		}
+		userHash = hashUserID(salt, *user)
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	ids := make([]int64, len(names))
+	for i, name := range names {
+		if ids[i], err = companyIDByName(ctx, db, name); err != nil {
+			log.Fatalf("company %q: %v", name, err)
+		}
+	}
+	candidates, skipped, err := loadPlanCandidates(ctx, db, ids, userHash)
+	if err != nil {
+		log.Fatalf("load candidates: %v", err)
+	}
+
+	plan := studyPlan{
+		Companies:    names,
+		Days:         *days,
+		Budget:       *budget,
+		Candidates:   len(candidates),
+		Skipped:      skipped,
+		Difficulties: map[string]int{},
+		Tags:         map[string]int{},
+		Schedule:     buildStudyPlan(candidates, *days, *budget, start),
+	}
+	for _, d := range plan.Schedule {
+		for _, p := range d.Problems {
+			plan.Difficulties[derefString(p.Difficulty)]++
+			for _, t := range p.Tags {
+				plan.Tags[t]++
+			}
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("create %s: %v", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(plan)
+	} else {
+		err = writePlanMarkdown(w, &plan)
+	}
+	if err != nil {
+		log.Fatalf("write plan: %v", err)
+	}
+}
+
+// writePlanMarkdown renders a plan as a checklist per day.
+func writePlanMarkdown(w io.Writer, plan *studyPlan) error {
+	var b strings.Builder
+	total := 0
+	for _, d := range plan.Schedule {
+		total += len(d.Problems)
+	}
+	fmt.Fprintf(&b, "# Study plan: %s\n\n", strings.Join(plan.Companies, ", "))
+	fmt.Fprintf(&b, "%d problems over %d days at %d minutes a day, out of %d open problems", total, plan.Days, plan.Budget, plan.Candidates)
+	if plan.Skipped > 0 {
+		fmt.Fprintf(&b, " (%d already completed)", plan.Skipped)
+	}
+	fmt.Fprintf(&b, ".\n\n- Difficulty: %s\n- Tags: %s\n", formatTagCounts(plan.Difficulties), formatTagCounts(plan.Tags))
+
+	for _, d := range plan.Schedule {
+		if len(d.Problems) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## Day %d, %s (%d min)\n\n", d.Day, d.Date, d.Minutes)
+		for _, p := range d.Problems {
+			title := derefString(p.Title)
+			if p.URL != nil {
+				title = fmt.Sprintf("[%s](%s)", title, *p.URL)
+			}
+			asked := make([]string, len(p.AskedBy))
+			for i, a := range p.AskedBy {
+				asked[i] = a.Company
+				if a.Timeframe != nil {
+					asked[i] += " (" + *a.Timeframe + ")"
+				}
+			}
+			fmt.Fprintf(&b, "- [ ] %s · %s", title, derefString(p.Difficulty))
+			if len(p.Tags) > 0 {
+				fmt.Fprintf(&b, " · %s", strings.Join(p.Tags, ", "))
+			}
+			fmt.Fprintf(&b, " · asked by %s\n", strings.Join(asked, ", "))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildStudyPlan(t *testing.T) {
+	problem := func(id int64, difficulty string, tag string, priority float64) planProblem {
+		p := planProblem{Tags: []string{tag}, Minutes: planMinutes[difficulty], priority: priority}
+		p.ID, p.Difficulty = id, &difficulty
+		return p
+	}
+	candidates := []planProblem{
+		problem(1, "Easy", "Array", 1.0),
+		problem(2, "Medium", "Array", 0.9),
+		problem(3, "Hard", "Graph", 0.5),
+		problem(4, "Medium", "Dynamic Programming", 0.1),
+	}
+	start := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	// 2 goes first (Medium is furthest below its share), then 1 although its tag is
+	// covered, into the same day; 3 fills day 2 and 4 no longer fits anywhere.
+	schedule := buildStudyPlan(candidates, 2, 60, start)
+
+	type day struct {
+		Date    string
+		Minutes int
+		IDs     []int64
+	}
+	var got []day
+	for _, d := range schedule {
+		dd := day{Date: d.Date, Minutes: d.Minutes}
+		for _, p := range d.Problems {
+			dd.IDs = append(dd.IDs, p.ID)
+		}
+		got = append(got, dd)
+	}
+	want := []day{
+		{Date: "2026-01-05", Minutes: 60, IDs: []int64{1, 2}}, // easy first within a day
+		{Date: "2026-01-06", Minutes: 60, IDs: []int64{3}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("schedule = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildStudyPlanEmpty(t *testing.T) {
+	hard := "Hard"
+	p := planProblem{Minutes: planMinutes[hard], priority: 1}
+	p.Difficulty = &hard
+
+	schedule := buildStudyPlan([]planProblem{p}, 3, 30, time.Now())
+	if len(schedule) != 3 {
+		t.Fatalf("%d days, want 3", len(schedule))
+	}
+	for _, d := range schedule {
+		if d.Problems == nil || len(d.Problems) != 0 || d.Minutes != 0 {
+			t.Errorf("day %d = %+v, want no problems", d.Day, d)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// popularityRecency weighs a company's ask by how recently it was asked (the company
+// problem's timeframe tag). Untagged problems were only asked more than six months ago.
+var popularityRecency = []struct {
+	Timeframe string
+	Weight    float64
+}{
+	{"thirty-days", 1},
+	{"three-months", 0.75},
+	{"six-months", 0.5},
+}
+
+const popularityUntaggedWeight = 0.25
+
+// refreshPopularity recomputes problems.popularity: the sum over the companies asking a
+// problem of recency weight * (1 + company frequency / 100) / 2, so each company adds at
+// most 1 (asked in the last thirty days at 100% frequency). Problems no company asks get 0.
+// updated_at only moves for problems whose score changed, so the delta sync pushes just those.
+func refreshPopularity(db *sqlx.DB) (int64, error) {
+	recency := "CASE cp.timeframe_tag"
+	for _, r := range popularityRecency {
+		recency += fmt.Sprintf(" WHEN '%s' THEN %g", r.Timeframe, r.Weight)
+	}
+	recency += fmt.Sprintf(" ELSE %g END", popularityUntaggedWeight)
+
+	res, err := db.Exec(fmt.Sprintf(`
+		WITH scores AS (
+		  SELECT p.id,
+		         round(coalesce(sum((%s) * (1 + coalesce(cp.frequency, 0) / 100) / 2)
+		                  FILTER (WHERE cp.problem_id IS NOT NULL), 0)::numeric, 4) AS score
+		  FROM problems p
+		  LEFT JOIN company_problems cp ON cp.problem_id = p.id
+		  GROUP BY p.id
+		)
+		UPDATE problems p
+		SET popularity = s.score, updated_at = now()
+		FROM scores s
+		WHERE s.id = p.id AND p.popularity IS DISTINCT FROM s.score::real`, recency))
+	if err != nil {
+		return 0, fmt.Errorf("update popularity: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// recencyWeight is the popularityRecency weight of a timeframe tag.
+func recencyWeight(timeframe *string) float64 {
+	if timeframe != nil {
+		for _, r := range popularityRecency {
+			if r.Timeframe == *timeframe {
+				return r.Weight
+			}
+		}
+	}
+	return popularityUntaggedWeight
+}
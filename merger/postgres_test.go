@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// testTables is the local schema from db/docs.md that the Postgres tests run against.
+const testTables = `
+CREATE TABLE companies (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE problems (
+  id BIGINT PRIMARY KEY,
+  url TEXT,
+  title TEXT,
+  difficulty TEXT,
+  acceptance REAL,
+  frequency REAL,
+  popularity REAL,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE TABLE company_problems (
+  company_id INTEGER NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+  problem_id BIGINT NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  source_file TEXT,
+  timeframe_tag TEXT,
+  frequency REAL,
+  last_seen TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (company_id, problem_id)
+);
+CREATE TABLE problem_tags (
+  problem_id BIGINT NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  added_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (problem_id, tag)
+);
+CREATE TABLE problem_relations (
+  problem_id BIGINT NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  related_id BIGINT NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  added_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (problem_id, related_id)
+);
+CREATE TABLE tag_scrape_runs (
+  id BIGSERIAL PRIMARY KEY,
+  started_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  finished_at TIMESTAMP WITH TIME ZONE,
+  last_problem_id BIGINT,
+  checkpoint_at TIMESTAMP WITH TIME ZONE
+);
+CREATE TABLE problem_tag_changes (
+  id BIGSERIAL PRIMARY KEY,
+  run_id BIGINT NOT NULL REFERENCES tag_scrape_runs(id) ON DELETE CASCADE,
+  problem_id BIGINT NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  change TEXT NOT NULL CHECK (change IN ('added', 'removed')),
+  changed_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE TABLE user_progress (
+  user_hash TEXT NOT NULL,
+  problem_id BIGINT NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  completed_at TIMESTAMP WITH TIME ZONE,
+  PRIMARY KEY (user_hash, problem_id)
+);
+CREATE TABLE problem_reviews (
+  user_hash TEXT NOT NULL,
+  problem_id BIGINT NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  quality SMALLINT NOT NULL,
+  reviewed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (user_hash, problem_id, reviewed_at)
+);
+CREATE TABLE review_schedule (
+  user_hash TEXT NOT NULL,
+  problem_id BIGINT NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  repetitions INTEGER NOT NULL,
+  interval_days INTEGER NOT NULL,
+  ease_factor REAL NOT NULL,
+  last_quality SMALLINT,
+  reviewed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  due_on DATE NOT NULL,
+  PRIMARY KEY (user_hash, problem_id)
+);
+CREATE TABLE company_similarity (
+  company_id INTEGER NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+  similar_id INTEGER NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+  method TEXT NOT NULL CHECK (method IN ('jaccard', 'weighted')),
+  score REAL NOT NULL,
+  shared_problems INTEGER NOT NULL,
+  rank INTEGER NOT NULL,
+  computed_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (company_id, similar_id, method)
+);
+`
+
+// testPostgres connects to the Postgres at TEST_DATABASE_URL inside a fresh schema holding
+// testTables, dropped when the test ends. Without TEST_DATABASE_URL the test is skipped.
+func testPostgres(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	admin, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("connect test db: %v", err)
+	}
+	schema := fmt.Sprintf("visor_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+		admin.Close()
+	})
+
+	// search_path is sent as a startup parameter, so every pooled connection gets it
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("connect test schema: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(testTables); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	return db
+}
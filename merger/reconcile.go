@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// LeetCode has two ids per question: the internal questionId and the questionFrontendId
+// shown on the site (and used by the CSVs, i.e. problems.id). They differ for many
+// problems, so only the frontend id can be compared with our ids.
+
+const (
+	fixNone = "none"
+	fixIDs  = "ids"  // move the row to the frontend id LeetCode reports for its slug
+	fixURLs = "urls" // point the row at the slug LeetCode reports for its id (if seen in this run)
+)
+
+// idMismatch is a problem whose URL slug resolves to a different frontend id than problems.id,
+// or to a frontend id that is not a number (Unparseable; FrontendID is then 0).
+type idMismatch struct {
+	ProblemID   int64
+	Slug        string
+	FrontendID  int64
+	RawFrontend string // questionFrontendId as LeetCode sent it
+	Unparseable bool
+	QuestionID  string
+	Action      string // what reconcileMismatches did about it
+}
+
+// frontend is the frontend id for logs and reports: the number, or the raw value if it
+// did not parse.
+func (m idMismatch) frontend() string {
+	if m.Unparseable {
+		return fmt.Sprintf("%q (unparseable)", m.RawFrontend)
+	}
+	return strconv.FormatInt(m.FrontendID, 10)
+}
+
+// reconcileMismatches applies the requested fix to every mismatch and fills in Action.
+// frontendSlugs maps frontend id -> slug for every question LeetCode returned in this run.
+// Unparseable mismatches are only reported: there is no id to move them to.
+func reconcileMismatches(db *sqlx.DB, mismatches []idMismatch, fix string, frontendSlugs map[int64]string) {
+	for i := range mismatches {
+		m := &mismatches[i]
+		switch {
+		case m.Unparseable:
+			m.Action = "reported: unparseable frontend id, not fixed"
+		case fix == fixIDs:
+			moved, err := moveProblemID(db, m.ProblemID, m.FrontendID)
+			switch {
+			case err != nil:
+				m.Action = "error: " + err.Error()
+			case !moved:
+				m.Action = fmt.Sprintf("skipped: problem %d already exists", m.FrontendID)
+			default:
+				m.Action = fmt.Sprintf("moved id %d -> %d", m.ProblemID, m.FrontendID)
+			}
+		case fix == fixURLs:
+			slug, ok := frontendSlugs[m.ProblemID]
+			if !ok {
+				m.Action = "skipped: correct slug unknown"
+				continue
+			}
+			url := "https://leetcode.com/problems/" + slug
+			if _, err := db.Exec("UPDATE problems SET url = $1, updated_at = now() WHERE id = $2", url, m.ProblemID); err != nil {
+				m.Action = "error: " + err.Error()
+			} else {
+				m.Action = "url set to " + url
+			}
+		default:
+			m.Action = "reported"
+		}
+		log.Printf("id mismatch: problem %d slug=%s is frontend id %s (questionId %s) — %s",
+			m.ProblemID, m.Slug, m.frontend(), m.QuestionID, m.Action)
+	}
+}
+
+// problemUserTables reference problems.id from data pulled from Supabase. They only exist
+// once the pull migration ran, so moveProblemID repoints them only where present.
+var problemUserTables = []string{"user_progress", "problem_reviews", "review_schedule"}
+
+// moveProblemID re-keys a problem from oldID to newID, repointing its company, tag,
+// relation and user rows. The foreign keys have no ON UPDATE CASCADE, so the row is copied
+// and the old one deleted. Returns false if newID is already taken.
+func moveProblemID(db *sqlx.DB, oldID, newID int64) (moved bool, err error) {
+	if newID <= 0 {
+		return false, fmt.Errorf("invalid target id %d", newID)
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil || !moved {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var taken bool
+	if err = tx.Get(&taken, "SELECT EXISTS (SELECT 1 FROM problems WHERE id = $1)", newID); err != nil {
+		return false, err
+	}
+	if taken {
+		return false, nil
+	}
+
+	stmts := []string{
+		`INSERT INTO problems (id, url, title, difficulty, acceptance, frequency, popularity, updated_at)
+		 SELECT $2, url, title, difficulty, acceptance, frequency, popularity, now() FROM problems WHERE id = $1`,
+		`UPDATE company_problems SET problem_id = $2 WHERE problem_id = $1`,
+		`UPDATE problem_tags SET problem_id = $2 WHERE problem_id = $1`,
+		`UPDATE problem_tag_changes SET problem_id = $2 WHERE problem_id = $1`,
+		`UPDATE problem_relations SET problem_id = $2 WHERE problem_id = $1`,
+		`UPDATE problem_relations SET related_id = $2 WHERE related_id = $1`,
+	}
+	for _, table := range problemUserTables {
+		var exists bool
+		if err = tx.Get(&exists, "SELECT to_regclass($1) IS NOT NULL", table); err != nil {
+			return false, err
+		}
+		if exists {
+			stmts = append(stmts, fmt.Sprintf("UPDATE %s SET problem_id = $2 WHERE problem_id = $1", pq.QuoteIdentifier(table)))
+		}
+	}
+	for _, q := range stmts {
+		if _, err = tx.Exec(q, oldID, newID); err != nil {
+			return false, err
+		}
+	}
+	// last: the delete cascades to whatever still points at oldID
+	if _, err = tx.Exec(`DELETE FROM problems WHERE id = $1`, oldID); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeReconcileReport writes the mismatches as CSV to path.
+func writeReconcileReport(path string, mismatches []idMismatch) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"problem_id", "slug", "frontend_id", "question_id", "action"}); err != nil {
+		return err
+	}
+	for _, m := range mismatches {
+		if err := w.Write([]string{
+			strconv.FormatInt(m.ProblemID, 10),
+			m.Slug,
+			m.RawFrontend,
+			m.QuestionID,
+			m.Action,
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMoveProblemID(t *testing.T) {
+	db := testPostgres(t)
+	db.MustExec(`
+		INSERT INTO companies (id, name) VALUES (1, 'Google');
+		INSERT INTO problems (id, url, title) VALUES
+		  (1, 'https://leetcode.com/problems/two-sum', 'Two Sum'),
+		  (2, 'https://leetcode.com/problems/3sum', '3Sum'),
+		  (3, 'https://leetcode.com/problems/4sum', '4Sum');
+		INSERT INTO company_problems (company_id, problem_id, frequency) VALUES (1, 1, 50);
+		INSERT INTO problem_tags (problem_id, tag) VALUES (1, 'Array'), (1, 'Hash Table');
+		INSERT INTO tag_scrape_runs (id) VALUES (1);
+		INSERT INTO problem_tag_changes (run_id, problem_id, tag, change) VALUES (1, 1, 'Array', 'added');
+		INSERT INTO problem_relations (problem_id, related_id) VALUES (1, 2), (2, 1);
+		INSERT INTO user_progress (user_hash, problem_id, completed_at) VALUES ('u1', 1, now());
+		INSERT INTO problem_reviews (user_hash, problem_id, quality, reviewed_at) VALUES ('u1', 1, 4, now());
+		INSERT INTO review_schedule (user_hash, problem_id, repetitions, interval_days, ease_factor, reviewed_at, due_on)
+		VALUES ('u1', 1, 1, 1, 2.5, now(), current_date + 1);`)
+
+	moved, err := moveProblemID(db, 1, 10)
+	if err != nil || !moved {
+		t.Fatalf("moveProblemID(1, 10) = %v, %v; want moved", moved, err)
+	}
+
+	var title string
+	if err := db.Get(&title, "SELECT title FROM problems WHERE id = 10"); err != nil || title != "Two Sum" {
+		t.Fatalf("problem 10: title %q, err %v", title, err)
+	}
+	counts := map[string]int{
+		"SELECT count(*) FROM problems WHERE id = 1":                                 0,
+		"SELECT count(*) FROM company_problems WHERE problem_id = 10":                1,
+		"SELECT count(*) FROM problem_tags WHERE problem_id = 10":                    2,
+		"SELECT count(*) FROM problem_tag_changes WHERE problem_id = 10":             1,
+		"SELECT count(*) FROM problem_relations WHERE problem_id = 10":               1,
+		"SELECT count(*) FROM problem_relations WHERE related_id = 10":               1,
+		"SELECT count(*) FROM user_progress WHERE problem_id = 10":                   1,
+		"SELECT count(*) FROM problem_reviews WHERE problem_id = 10":                 1,
+		"SELECT count(*) FROM review_schedule WHERE problem_id = 10":                 1,
+		"SELECT count(*) FROM problem_relations WHERE 1 IN (problem_id, related_id)": 0,
+	}
+	for q, want := range counts {
+		var n int
+		if err := db.Get(&n, q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		if n != want {
+			t.Errorf("%s = %d, want %d", q, n, want)
+		}
+	}
+
+	if moved, err := moveProblemID(db, 2, 3); err != nil || moved {
+		t.Errorf("moveProblemID onto a taken id = %v, %v; want not moved", moved, err)
+	}
+	if _, err := moveProblemID(db, 2, 0); err == nil {
+		t.Error("moveProblemID(2, 0) succeeded")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// relatedProblem is a problem reached while walking problem_relations
+type relatedProblem struct {
+	ID         int64          `db:"id"`
+	Title      sql.NullString `db:"title"`
+	Difficulty sql.NullString `db:"difficulty"`
+	Tags       pq.StringArray `db:"tags"`
+	Depth      int            `db:"-"`
+	Via        int64          `db:"-"` // problem we came from (0 for the root)
+}
+
+// relatedMain prints the similar-problems neighborhood of a problem.
+// Usage: go run . related [-depth N] <problem id | slug>
+func relatedMain(args []string) {
+	fs := flag.NewFlagSet("related", flag.ExitOnError)
+	depth := fs.Int("depth", 2, "how many hops of similar problems to walk")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: related [-depth N] <problem id | slug>")
+	}
+	if *depth < 0 {
+		log.Fatalf("depth must be >= 0")
+	}
+
+	godotenv.Load()
+
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer db.Close()
+
+	rootID, err := resolveProblemRef(db, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("resolve %q: %v", fs.Arg(0), err)
+	}
+
+	found, err := walkRelations(db, rootID, *depth)
+	if err != nil {
+		log.Fatalf("walk relations: %v", err)
+	}
+
+	// print as a tree: every problem under the one it was first reached from
+	children := map[int64][]relatedProblem{}
+	for _, p := range found[1:] {
+		children[p.Via] = append(children[p.Via], p)
+	}
+	var printTree func(p relatedProblem)
+	printTree = func(p relatedProblem) {
+		fmt.Println(formatRelated(p))
+		for _, c := range children[p.ID] {
+			printTree(c)
+		}
+	}
+	printTree(found[0])
+	log.Printf("%d related problems within depth %d", len(found)-1, *depth)
+}
+
+func formatRelated(p relatedProblem) string {
+	indent := strings.Repeat("  ", p.Depth)
+	title := p.Title.String
+	if !p.Title.Valid {
+		title = "(untitled)"
+	}
+	difficulty := p.Difficulty.String
+	if !p.Difficulty.Valid || difficulty == "" {
+		difficulty = "?"
+	}
+	tags := "-"
+	if len(p.Tags) > 0 {
+		tags = strings.Join(p.Tags, ", ")
+	}
+	return fmt.Sprintf("%s%d. %s (%s) [%s]", indent, p.ID, title, difficulty, tags)
+}
+
+// resolveProblemRef accepts either a numeric problem id or a LeetCode title slug.
+func resolveProblemRef(db *sqlx.DB, ref string) (int64, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		var exists bool
+		if err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM problems WHERE id = $1)", id); err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, fmt.Errorf("problem %d not found", id)
+		}
+		return id, nil
+	}
+
+	// slugs are not stored, so match them the same way the tag scraper derives them
+	var problems []DBProblem
+	if err := db.Select(&problems, "SELECT id, url FROM problems WHERE url LIKE '%/problems/' || $1 || '%'", ref); err != nil {
+		return 0, err
+	}
+	for _, p := range problems {
+		if extractSlug(p.URL) == ref {
+			return p.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("no problem with slug %q", ref)
+}
+
+// walkRelations does a breadth-first walk over problem_relations (in both directions)
+// starting at rootID, up to maxDepth hops. Results are returned in walk order.
+func walkRelations(db *sqlx.DB, rootID int64, maxDepth int) ([]relatedProblem, error) {
+	depthOf := map[int64]int{rootID: 0}
+	viaOf := map[int64]int64{}
+	order := []int64{rootID}
+	frontier := []int64{rootID}
+
+	for d := 1; d <= maxDepth && len(frontier) > 0; d++ {
+		var edges []struct {
+			From int64 `db:"from_id"`
+			To   int64 `db:"to_id"`
+		}
+		if err := db.Select(&edges, `
+			SELECT problem_id AS from_id, related_id AS to_id FROM problem_relations WHERE problem_id = ANY($1)
+			UNION
+			SELECT related_id AS from_id, problem_id AS to_id FROM problem_relations WHERE related_id = ANY($1)
+			ORDER BY from_id, to_id
+		`, pq.Array(frontier)); err != nil {
+			return nil, err
+		}
+
+		var next []int64
+		for _, e := range edges {
+			if _, seen := depthOf[e.To]; seen {
+				continue
+			}
+			depthOf[e.To] = d
+			viaOf[e.To] = e.From
+			order = append(order, e.To)
+			next = append(next, e.To)
+		}
+		frontier = next
+	}
+
+	var details []relatedProblem
+	if err := db.Select(&details, `
+		SELECT p.id, p.title, p.difficulty,
+		       COALESCE(array_agg(t.tag ORDER BY t.tag) FILTER (WHERE t.tag IS NOT NULL), '{}') AS tags
+		FROM problems p
+		LEFT JOIN problem_tags t ON t.problem_id = p.id
+		WHERE p.id = ANY($1)
+		GROUP BY p.id
+	`, pq.Array(order)); err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]relatedProblem, len(details))
+	for _, p := range details {
+		byID[p.ID] = p
+	}
+
+	out := make([]relatedProblem, 0, len(order))
+	for _, id := range order {
+		p, ok := byID[id]
+		if !ok {
+			p = relatedProblem{ID: id}
+		}
+		p.Depth = depthOf[id]
+		p.Via = viaOf[id]
+		out = append(out, p)
+	}
+	return out, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// problemReviewsSpec pulls Supabase's review attempts into the local problem_reviews,
+// with user ids hashed like userProgressSpec.
+func problemReviewsSpec(salt string) tableSpec {
+	return tableSpec{
+		Name:      "problem_reviews",
+		Columns:   []string{"user_hash", "problem_id", "quality", "reviewed_at"},
+		Select:    []string{"user_id", "problem_id", "quality", "reviewed_at"},
+		Key:       []string{"user_hash", "problem_id", "reviewed_at"},
+		Watermark: "reviewed_at",
+		Transform: hashFirstColumn(salt),
+	}
+}
+
+// reviewScheduleSpec pulls the SM-2 state Supabase keeps per user and problem. It is
+// copied rather than recomputed, so both databases always agree on what is due.
+func reviewScheduleSpec(salt string) tableSpec {
+	return tableSpec{
+		Name:      "review_schedule",
+		Columns:   []string{"user_hash", "problem_id", "repetitions", "interval_days", "ease_factor", "last_quality", "reviewed_at", "due_on"},
+		Select:    []string{"user_id", "problem_id", "repetitions", "interval_days", "ease_factor", "last_quality", "reviewed_at", "due_on"},
+		Key:       []string{"user_hash", "problem_id"},
+		Update:    []string{"repetitions", "interval_days", "ease_factor", "last_quality", "reviewed_at", "due_on"},
+		Watermark: "reviewed_at",
+		Transform: hashFirstColumn(salt),
+	}
+}
+
+// sm2State is a problem's place in a user's SM-2 schedule, as review_schedule keeps it.
+type sm2State struct {
+	Repetitions  int
+	IntervalDays int
+	EaseFactor   float64
+}
+
+// next is the state after a review of quality 0-5. It mirrors apply_problem_review on
+// Supabase, which owns the schedule; here it only previews what a rating would do.
+func (s sm2State) next(quality int) sm2State {
+	if quality < 3 {
+		s.Repetitions, s.IntervalDays = 0, 1
+	} else {
+		switch s.Repetitions {
+		case 0:
+			s.IntervalDays = 1
+		case 1:
+			s.IntervalDays = 6
+		default:
+			// Postgres rounds double precision ties to even
+			s.IntervalDays = int(math.RoundToEven(float64(s.IntervalDays) * s.EaseFactor))
+		}
+		s.Repetitions++
+	}
+	q := float64(5 - quality)
+	// ease_factor is a REAL column
+	s.EaseFactor = float64(float32(max(1.3, s.EaseFactor+0.1-q*(0.08+q*0.02))))
+	return s
+}
+
+// dueReview is a problem whose next review is due.
+type dueReview struct {
+	exportProblem
+	Tags         pq.StringArray `db:"tags" json:"tags"`
+	Repetitions  int            `db:"repetitions" json:"repetitions"`
+	IntervalDays int            `db:"interval_days" json:"interval_days"`
+	EaseFactor   float64        `db:"ease_factor" json:"ease_factor"`
+	LastQuality  *int           `db:"last_quality" json:"last_quality"`
+	ReviewedAt   time.Time      `db:"reviewed_at" json:"reviewed_at"`
+	DueOn        time.Time      `db:"due_on" json:"due_on"`
+	// NextIntervals are the days until the following review for a rating of 0 to 5.
+	NextIntervals []int `db:"-" json:"next_interval_days"`
+}
+
+// dueReviews returns userHash's reviews due on or before day, longest overdue first, then
+// the hardest (lowest ease factor), and the total number due.
+func dueReviews(ctx context.Context, db *sqlx.DB, userHash string, day time.Time, limit, offset int) ([]dueReview, int64, error) {
+	date := day.Format("2006-01-02")
+	out := []dueReview{}
+	if err := db.SelectContext(ctx, &out, `
+		SELECT p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at,
+		       ARRAY(SELECT tag FROM problem_tags WHERE problem_id = p.id ORDER BY tag) AS tags,
+		       s.repetitions, s.interval_days, s.ease_factor, s.last_quality, s.reviewed_at, s.due_on
+		FROM review_schedule s
+		JOIN problems p ON p.id = s.problem_id
+		WHERE s.user_hash = $1 AND s.due_on <= $2::date
+		ORDER BY s.due_on, s.ease_factor, p.id
+		LIMIT $3 OFFSET $4`, userHash, date, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	for i := range out {
+		r := &out[i]
+		s := sm2State{Repetitions: r.Repetitions, IntervalDays: r.IntervalDays, EaseFactor: r.EaseFactor}
+		for q := 0; q <= 5; q++ {
+			r.NextIntervals = append(r.NextIntervals, s.next(q).IntervalDays)
+		}
+	}
+	var total int64
+	err := db.GetContext(ctx, &total, `
+		SELECT count(*) FROM review_schedule WHERE user_hash = $1 AND due_on <= $2::date`, userHash, date)
+	return out, total, err
+}
+
+// reviewMain prints a user's review queue from the pulled review_schedule.
+// Usage: go run . review -user id [-date YYYY-MM-DD] [-limit n]
+//
+//	go run . review -hash user_hash ...
+func reviewMain(args []string) {
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	user := fs.String("user", "", "Supabase user id (hashed with USER_HASH_SALT)")
+	hash := fs.String("hash", "", "user hash as stored locally, instead of -user")
+	date := fs.String("date", time.Now().Format("2006-01-02"), "list reviews due on or before this date")
+	limit := fs.Int("limit", 50, "number of reviews to print")
+	fs.Parse(args)
+
+	day, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		log.Fatalf("bad -date: %v", err)
+	}
+	godotenv.Load()
+	userHash := *hash
+	if *user != "" {
+		salt := os.Getenv("USER_HASH_SALT")
+		if salt == "" {
+			log.Fatalf("USER_HASH_SALT environment variable is required with -user")
+		}
+		userHash = hashUserID(salt, *user)
+	}
+	if userHash == "" {
+		log.Fatalf("usage: review -user id | review -hash user_hash [-date d] [-limit n]")
+	}
+
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer db.Close()
+
+	due, total, err := dueReviews(context.Background(), db, userHash, day, *limit, 0)
+	if err != nil {
+		log.Fatalf("due reviews: %v", err)
+	}
+	for _, r := range due {
+		fmt.Printf("%5d  %-6s  %-50s  due %s  rep %d  ef %.2f  %s\n", r.ID, derefString(r.Difficulty), derefString(r.Title),
+			r.DueOn.Format("2006-01-02"), r.Repetitions, r.EaseFactor, strings.Join(r.Tags, ", "))
+	}
+	fmt.Printf("%d of %d reviews due by %s\n", len(due), total, day.Format("2006-01-02"))
+}
+
+// GET /reviews/due?user=<hash>[&date=YYYY-MM-DD&limit=&offset=]: the user's review queue.
+// user is the hash from user_progress; real user ids never reach the local db.
+func (s *apiServer) handleDueReviews(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	user := v.Get("user")
+	if user == "" {
+		writeError(w, http.StatusBadRequest, "user is required")
+		return
+	}
+	day := time.Now()
+	if d := v.Get("date"); d != "" {
+		var err error
+		if day, err = time.Parse("2006-01-02", d); err != nil {
+			writeError(w, http.StatusBadRequest, "date must be YYYY-MM-DD")
+			return
+		}
+	}
+	limit, offset, err := pageParams(v.Get("limit"), v.Get("offset"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	due, total, err := dueReviews(r.Context(), s.db, user, day, limit, offset)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiPage{Items: due, Total: total, Limit: limit, Offset: offset})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSM2Next(t *testing.T) {
+	// one problem reviewed again and again, starting from a fresh schedule row
+	s := sm2State{Repetitions: 0, IntervalDays: 1, EaseFactor: 2.5}
+	steps := []struct {
+		quality      int
+		wantReps     int
+		wantInterval int
+		wantEase     float64
+	}{
+		{quality: 5, wantReps: 1, wantInterval: 1, wantEase: 2.6},
+		{quality: 5, wantReps: 2, wantInterval: 6, wantEase: 2.7},
+		{quality: 4, wantReps: 3, wantInterval: 16, wantEase: 2.7},  // round(6 * 2.7)
+		{quality: 3, wantReps: 4, wantInterval: 43, wantEase: 2.56}, // round(16 * 2.7)
+		{quality: 2, wantReps: 0, wantInterval: 1, wantEase: 2.24},  // a lapse restarts it
+		{quality: 5, wantReps: 1, wantInterval: 1, wantEase: 2.34},
+	}
+	for i, st := range steps {
+		s = s.next(st.quality)
+		if s.Repetitions != st.wantReps || s.IntervalDays != st.wantInterval || math.Abs(s.EaseFactor-st.wantEase) > 1e-6 {
+			t.Fatalf("step %d (quality %d) = %+v, want %d repetitions, %d days, ease %.2f",
+				i, st.quality, s, st.wantReps, st.wantInterval, st.wantEase)
+		}
+	}
+}
+
+func TestSM2NextBounds(t *testing.T) {
+	if got := (sm2State{Repetitions: 3, IntervalDays: 20, EaseFactor: 1.4}).next(0); got.EaseFactor != float64(float32(1.3)) {
+		t.Errorf("ease after a blackout = %v, want the 1.3 floor", got.EaseFactor)
+	}
+	// 10 * 2.25 = 22.5 rounds to even, like round(double precision) in Postgres
+	if got := (sm2State{Repetitions: 2, IntervalDays: 10, EaseFactor: 2.25}).next(4); got.IntervalDays != 22 {
+		t.Errorf("interval = %d, want 22", got.IntervalDays)
+	}
+}
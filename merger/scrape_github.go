@@ -193,7 +193,7 @@ func upsertProblem(tx *sqlx.Tx, p RawProblem) error {
 	return err
 }
 
-func upsertCompanyProblem(tx *sqlx.Tx, companyID int, problemID int64, sourceFile string, timeFrameTag *string) error {
+func upsertCompanyProblem(tx *sqlx.Tx, companyID int, problemID int64, sourceFile string, timeFrameTag *string, frequency sql.NullFloat64) error {
 	var tf interface{}
 	if timeFrameTag != nil {
 		tf = *timeFrameTag
@@ -201,13 +201,14 @@ func upsertCompanyProblem(tx *sqlx.Tx, companyID int, problemID int64, sourceFil
 		tf = nil
 	}
 	_, err := tx.Exec(`
-	INSERT INTO company_problems (company_id, problem_id, source_file, timeframe_tag, last_seen)
-	VALUES ($1,$2,$3,$4, now())
+	INSERT INTO company_problems (company_id, problem_id, source_file, timeframe_tag, frequency, last_seen)
+	VALUES ($1,$2,$3,$4,$5, now())
 	ON CONFLICT (company_id, problem_id) DO UPDATE
 	  SET source_file = EXCLUDED.source_file,
 	      timeframe_tag = EXCLUDED.timeframe_tag,
+	      frequency = EXCLUDED.frequency,
 	      last_seen = now()
-	`, companyID, problemID, sourceFile, tf)
+	`, companyID, problemID, sourceFile, tf, nullableFloat64(frequency))
 	return err
 }
 
@@ -351,7 +352,8 @@ func scrapeGithubMain() {
 			}
 
 			src := sourceFor[id]
-			if err := upsertCompanyProblem(tx, companyID, id, src, timeFrameTag); err != nil {
+			// problems.frequency is overwritten by every company; keep this company's own value
+			if err := upsertCompanyProblem(tx, companyID, id, src, timeFrameTag, rp.Frequency); err != nil {
 				log.Printf("upsert company_problem %s:%d: %v", companyName, id, err)
 				continue
 			}
@@ -366,6 +368,7 @@ func scrapeGithubMain() {
 		}
 		log.Printf("[DONE]: %s (%d problems)", companyName, len(meta))
 	}
+	refreshDerived(db)
 	log.Printf("All done!")
 
 }
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -14,15 +13,19 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 const (
-	graphqlURL = "https://leetcode.com/graphql"
+	defaultGraphQLURL = "https://leetcode.com/graphql"
 	// batchSize is how many problems we request in a single HTTP call using aliases.
 	batchSize       = 40
 	politeSleepMS   = 300 // milliseconds between batch requests
 	httpTimeoutSecs = 20
+	// a 429 or 5xx answer is retried up to graphqlRetries times, waiting graphqlBackoff,
+	// then twice as long, ... (or what Retry-After asks for)
+	graphqlRetries = 3
+	graphqlBackoff = 2 * time.Second
 )
 
 type DBProblem struct {
@@ -30,24 +33,28 @@ type DBProblem struct {
 	URL string `db:"url"`
 }
 
-// GraphQL response dynamic mapping: keys are q0, q1, ...
-type questionEntry struct {
-	QuestionId string `json:"questionId"`
-	TopicTags  []struct {
-		Name string `json:"name"`
-		Slug string `json:"slug"`
-	} `json:"topicTags"`
-}
-type batchResponse struct {
-	Data   map[string]questionEntry `json:"data"`
-	Errors []interface{}            `json:"errors"`
+// similarQuestion is one element of the decoded similarQuestions string
+type similarQuestion struct {
+	Title      string `json:"title"`
+	TitleSlug  string `json:"titleSlug"`
+	Difficulty string `json:"difficulty"`
 }
 type pslug struct {
 	ID   int64
 	Slug string
 }
 
-func scrapeTagsMain() {
+func scrapeTagsMain(args []string) {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	fix := fs.String("fix", fixNone, "what to do when a slug belongs to another frontend id: none, ids or urls")
+	report := fs.String("report", "", "write an id reconciliation report (CSV) to this path")
+	endpoint := fs.String("endpoint", defaultGraphQLURL, "GraphQL endpoint to query")
+	resume := fs.Bool("resume", false, "continue the last unfinished run from its checkpoint")
+	fs.Parse(args)
+	if *fix != fixNone && *fix != fixIDs && *fix != fixURLs {
+		log.Fatalf("invalid -fix %q (want none, ids or urls)", *fix)
+	}
+
 	godotenv.Load()
 
 	dsn := os.Getenv("LOCAL_DATABASE_URL")
@@ -61,9 +68,10 @@ func scrapeTagsMain() {
 	}
 	defer db.Close()
 
-	// Load problems that have URLs (so we can extract slug)
+	// Load problems that have URLs (so we can extract slug), in id order so the
+	// checkpoint (last completed problem id) tells exactly what is left to do
 	var problems []DBProblem
-	if err := db.Select(&problems, "SELECT id, url FROM problems WHERE url IS NOT NULL"); err != nil {
+	if err := db.Select(&problems, "SELECT id, url FROM problems WHERE url IS NOT NULL ORDER BY id"); err != nil {
 		log.Fatalf("select problems: %v", err)
 	}
 	log.Printf("Found %d problems with URLs in DB\n", len(problems))
@@ -84,7 +92,51 @@ func scrapeTagsMain() {
 	}
 	log.Printf("Prepared %d problems with valid slugs\n", len(items))
 
-	client := &http.Client{Timeout: time.Second * httpTimeoutSecs}
+	// slug -> id, used to resolve similarQuestions into problem_relations edges
+	slugToID := make(map[string]int64, len(items))
+	for _, it := range items {
+		slugToID[it.Slug] = it.ID
+	}
+
+	client := newGraphQLClient(*endpoint, nil)
+
+	var runID, cursor int64
+	if *resume {
+		run, err := lastUnfinishedTagRun(db)
+		if err != nil {
+			log.Fatalf("find run to resume: %v", err)
+		}
+		if run == nil {
+			log.Printf("no unfinished run to resume — starting a new one")
+		} else {
+			runID, cursor = run.ID, run.LastProblemID.Int64
+			log.Printf("resuming tag scrape run %d after problem %d", runID, cursor)
+		}
+	}
+	if runID == 0 {
+		if runID, err = startTagRun(db); err != nil {
+			log.Fatalf("start tag run: %v", err)
+		}
+		log.Printf("tag scrape run %d", runID)
+	}
+	summary := newTagChangeSummary()
+
+	// skip what the resumed run already completed
+	if cursor > 0 {
+		done := 0
+		for done < len(items) && items[done].ID <= cursor {
+			done++
+		}
+		items = items[done:]
+		log.Printf("%d problems already done, %d left", done, len(items))
+	}
+	progress := newProgress(len(items))
+	// the checkpoint only moves over a contiguous prefix of completed batches, so a
+	// resumed run retries everything from the first failed batch on
+	contiguous := true
+
+	var mismatches []idMismatch
+	frontendSlugs := map[int64]string{} // every frontend id -> slug LeetCode answered with
 
 	// Process in batches
 	total := len(items)
@@ -94,37 +146,61 @@ func scrapeTagsMain() {
 			j = total
 		}
 		batch := items[i:j]
-		log.Printf("Processing batch %d..%d (size %d)", i, j-1, len(batch))
+		log.Printf("Processing batch %d..%d (size %d) — %s", i, j-1, len(batch), progress)
 
-		// Build GraphQL query with aliases q0, q1, ...
-		q := buildBatchQuery(batch)
-		respBody, err := doGraphQLRequest(client, q)
+		// Query with aliases q0, q1, ... and slugs passed as variables $s0, $s1, ...
+		br, err := client.queryBatch(batch)
 		if err != nil {
 			log.Printf("GraphQL request failed for batch %d..%d: %v — skipping this batch", i, j-1, err)
+			contiguous = false
+			progress.advance(len(batch))
 			time.Sleep(time.Millisecond * politeSleepMS)
 			continue
 		}
 
-		// Parse JSON into struct
-		var br batchResponse
-		if err := json.Unmarshal(respBody, &br); err != nil {
-			log.Printf("json unmarshal failed for batch %d..%d: %v", i, j-1, err)
-			time.Sleep(time.Millisecond * politeSleepMS)
-			continue
+		// Errors that cannot be tied to an alias concern the whole batch; the rest are
+		// reported next to the problem they belong to (data is still processed if present)
+		aliasErrors := br.errorsByAlias()
+		for _, e := range aliasErrors[""] {
+			log.Printf("GraphQL error for batch %d..%d: %s", i, j-1, e.Message)
 		}
 
-		// If GraphQL returned errors, log them (but still attempt to process data if present)
-		if len(br.Errors) > 0 {
-			log.Printf("GraphQL errors for batch %d..%d: %v", i, j-1, br.Errors)
-		}
-
-		// For each alias in the batch, map results and update DB per problem
+		// For each alias in the batch, map results; the whole batch is written at once below
+		var scraped []scrapedProblem
 		for idx, p := range batch {
-			alias := fmt.Sprintf("q%d", idx)
-			entry, ok := br.Data[alias]
-			if !ok || entry.QuestionId == "" {
+			alias := batchAlias(idx)
+			entry := br.Data[alias]
+			missing := entry == nil || entry.QuestionId == ""
+			for _, e := range aliasErrors[alias] {
+				if missing {
+					log.Printf("GraphQL error for problem id=%d slug=%s (alias=%s): %s — skipping", p.ID, p.Slug, alias, e.Message)
+				} else {
+					log.Printf("GraphQL error for problem id=%d slug=%s (alias=%s): %s — using the partial data", p.ID, p.Slug, alias, e.Message)
+				}
+			}
+			if missing {
 				// Missing -> skip and do not delete tags (safer)
-				log.Printf("no data for problem id=%d slug=%s (alias=%s) — skipping", p.ID, p.Slug, alias)
+				if len(aliasErrors[alias]) == 0 {
+					log.Printf("no data for problem id=%d slug=%s (alias=%s) — skipping", p.ID, p.Slug, alias)
+				}
+				continue
+			}
+
+			// The slug must resolve to the same frontend id as the CSV; otherwise the tags
+			// belong to another problem and are not written.
+			frontendID, err := strconv.ParseInt(strings.TrimSpace(entry.QuestionFrontendId), 10, 64)
+			if err == nil {
+				frontendSlugs[frontendID] = p.Slug
+			}
+			if err != nil || frontendID != p.ID {
+				mismatches = append(mismatches, idMismatch{
+					ProblemID:   p.ID,
+					Slug:        p.Slug,
+					FrontendID:  frontendID,
+					RawFrontend: entry.QuestionFrontendId,
+					Unparseable: err != nil,
+					QuestionID:  entry.QuestionId,
+				})
 				continue
 			}
 
@@ -138,97 +214,228 @@ func scrapeTagsMain() {
 				}
 			}
 
-			// Update DB for this problem: delete old tags, insert new tags, within a transaction
-			if err := replaceProblemTags(db, p.ID, tags); err != nil {
-				log.Printf("db update failed for problem %d: %v", p.ID, err)
-			} else {
-				log.Printf("updated problem %d with %d tags", p.ID, len(tags))
+			// Similar questions -> edges to problems we know about; unknown slugs are ignored
+			related, unknown := resolveSimilar(entry.SimilarQuestions, slugToID)
+			if unknown > 0 {
+				log.Printf("problem %d: %d similar problems not in DB", p.ID, unknown)
 			}
+			scraped = append(scraped, scrapedProblem{ID: p.ID, Tags: tags, Related: related})
 		}
 
+		// One transaction, one COPY for the whole batch
+		diffs, err := writeScrapedBatch(db, runID, scraped)
+		if err != nil {
+			log.Printf("db update failed for batch %d..%d: %v", i, j-1, err)
+			contiguous = false
+		} else {
+			for _, sp := range scraped {
+				d := diffs[sp.ID]
+				summary.add(d)
+				log.Printf("updated problem %d with %d tags (+%d -%d), %d related", sp.ID, len(sp.Tags), len(d.Added), len(d.Removed), len(sp.Related))
+			}
+		}
+
+		if contiguous {
+			if err := checkpointTagRun(db, runID, batch[len(batch)-1].ID); err != nil {
+				log.Printf("checkpoint run %d: %v", runID, err)
+			}
+		}
+		progress.advance(len(batch))
+
 		// polite sleep between batch requests
 		time.Sleep(time.Millisecond * politeSleepMS)
 	}
 
+	if len(mismatches) > 0 {
+		log.Printf("%d problems have a slug that belongs to another frontend id (fix=%s)", len(mismatches), *fix)
+		reconcileMismatches(db, mismatches, *fix, frontendSlugs)
+	}
+	if *report != "" {
+		if err := writeReconcileReport(*report, mismatches); err != nil {
+			log.Printf("write reconciliation report: %v", err)
+		} else {
+			log.Printf("reconciliation report written to %s (%d rows)", *report, len(mismatches))
+		}
+	}
+
+	// a run with failed batches stays unfinished, so -resume picks it up at its checkpoint
+	if contiguous {
+		if err := finishTagRun(db, runID); err != nil {
+			log.Printf("finish tag run %d: %v", runID, err)
+		}
+	}
+	summary.print(runID)
+
+	refreshDerived(db)
+
+	if !contiguous {
+		log.Fatalf("tag run %d had failed batches; rerun with -resume to retry from the first one", runID)
+	}
 	log.Println("Tag sync complete.")
 }
 
-// create a GraphQL query string with aliases q0..qN for the provided slugs.
-func buildBatchQuery(batch []pslug) string {
-	var sb strings.Builder
-	sb.WriteString("query {\n")
-	for i, p := range batch {
-		// use strconv.Quote to safely produce a quoted, escaped string literal
-		quoted := strconv.Quote(p.Slug)
-		sb.WriteString(fmt.Sprintf("  q%d: question(titleSlug: %s) {\n", i, quoted))
-		sb.WriteString("    questionId\n")
-		sb.WriteString("    topicTags { name slug }\n")
-		sb.WriteString("  }\n")
-	}
-	sb.WriteString("}\n")
-	return sb.String()
+// scrapedProblem is what the scraper learned about one problem.
+type scrapedProblem struct {
+	ID      int64
+	Tags    []string
+	Related []int64
 }
 
-func doGraphQLRequest(client *http.Client, query string) ([]byte, error) {
-	bodyMap := map[string]interface{}{"query": query}
-	bodyBytes, _ := json.Marshal(bodyMap)
-
-	req, err := http.NewRequest("POST", graphqlURL, bytes.NewReader(bodyBytes))
-	if err != nil {
-		return nil, err
+// writeScrapedBatch stores tags and similar-problem edges for a whole batch in one transaction.
+// Everything is streamed with a single COPY into a temp table, then merged with set-based
+// statements: only new tags are inserted and only vanished ones deleted, so added_at keeps
+// its meaning, and every tag change is logged to problem_tag_changes under runID.
+// A problem with no tags (or no related problems) gets all of them removed (clean sync).
+func writeScrapedBatch(db *sqlx.DB, runID int64, batch []scrapedProblem) (diffs map[int64]tagDiff, err error) {
+	diffs = map[int64]tagDiff{}
+	if len(batch) == 0 {
+		return diffs, nil
 	}
-	req.Header.Set("Content-Type", "application/json")
-	// set user agent to avoid potential filtering
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; tag-sync/1.0)")
 
-	resp, err := client.Do(req)
+	tx, err := db.Beginx()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
 
-	// Accept non-200 too (GraphQL commonly returns 200 even on errors); but if 429 or 5xx, return error
-	if resp.StatusCode >= 500 || resp.StatusCode == 429 {
-		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	// one row per problem (tag and related_id NULL) marks it as scraped, then one row
+	// per tag and per related problem
+	if _, err = tx.Exec(`
+CREATE TEMP TABLE temp_scraped (
+  problem_id bigint,
+  tag text,
+  related_id bigint
+) ON COMMIT DROP;
+`); err != nil {
+		return nil, fmt.Errorf("create temp_scraped: %w", err)
 	}
 
-	var respBytes []byte
-	respBytes, err = ioReadAll(resp.Body)
+	stmt, err := tx.Prepare(pq.CopyIn("temp_scraped", "problem_id", "tag", "related_id"))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("prepare copyin scraped: %w", err)
+	}
+	for _, sp := range batch {
+		if _, err = stmt.Exec(sp.ID, nil, nil); err != nil {
+			stmt.Close()
+			return nil, fmt.Errorf("copy exec scraped: %w", err)
+		}
+		for _, t := range sp.Tags {
+			if _, err = stmt.Exec(sp.ID, t, nil); err != nil {
+				stmt.Close()
+				return nil, fmt.Errorf("copy exec tag: %w", err)
+			}
+		}
+		for _, rid := range sp.Related {
+			if _, err = stmt.Exec(sp.ID, nil, rid); err != nil {
+				stmt.Close()
+				return nil, fmt.Errorf("copy exec relation: %w", err)
+			}
+		}
+	}
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		return nil, fmt.Errorf("final copy exec scraped: %w", err)
+	}
+	if err = stmt.Close(); err != nil {
+		return nil, fmt.Errorf("close copy stmt: %w", err)
 	}
-	return respBytes, nil
-}
 
-// replaceProblemTags deletes existing tags for problem_id and inserts the provided tags.
-// It uses a transaction; if tags is empty it will delete all tags (clean sync).
-func replaceProblemTags(db *sqlx.DB, problemID int64, tags []string) error {
-	tx, err := db.Beginx()
-	if err != nil {
-		return err
+	// tags: delete removed, insert added and log both, in a single statement
+	var changes []struct {
+		ProblemID int64  `db:"problem_id"`
+		Tag       string `db:"tag"`
+		Change    string `db:"change"`
 	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
+	if err = tx.Select(&changes, `
+WITH scraped AS (
+  SELECT DISTINCT problem_id FROM temp_scraped
+), wanted AS (
+  SELECT DISTINCT problem_id, tag FROM temp_scraped WHERE tag IS NOT NULL
+), removed AS (
+  DELETE FROM problem_tags pt
+  USING scraped s
+  WHERE pt.problem_id = s.problem_id
+    AND NOT EXISTS (SELECT 1 FROM wanted w WHERE w.problem_id = pt.problem_id AND w.tag = pt.tag)
+  RETURNING pt.problem_id, pt.tag
+), added AS (
+  INSERT INTO problem_tags (problem_id, tag)
+  SELECT problem_id, tag FROM wanted
+  ON CONFLICT (problem_id, tag) DO NOTHING
+  RETURNING problem_id, tag
+), logged AS (
+  INSERT INTO problem_tag_changes (run_id, problem_id, tag, change)
+  SELECT $1, problem_id, tag, 'added' FROM added
+  UNION ALL
+  SELECT $1, problem_id, tag, 'removed' FROM removed
+  RETURNING problem_id, tag, change
+)
+SELECT problem_id, tag, change FROM logged ORDER BY problem_id, tag
+`, runID); err != nil {
+		return nil, fmt.Errorf("merge tags: %w", err)
+	}
+	for _, c := range changes {
+		d := diffs[c.ProblemID]
+		if c.Change == "added" {
+			d.Added = append(d.Added, c.Tag)
+		} else {
+			d.Removed = append(d.Removed, c.Tag)
 		}
-	}()
+		diffs[c.ProblemID] = d
+	}
 
-	if _, err = tx.Exec("DELETE FROM problem_tags WHERE problem_id = $1", problemID); err != nil {
-		return err
+	// similar-problem edges going out of the scraped problems
+	if _, err = tx.Exec(`
+WITH scraped AS (
+  SELECT DISTINCT problem_id FROM temp_scraped
+), wanted AS (
+  SELECT DISTINCT problem_id, related_id FROM temp_scraped
+  WHERE related_id IS NOT NULL AND related_id <> problem_id
+), removed AS (
+  DELETE FROM problem_relations r
+  USING scraped s
+  WHERE r.problem_id = s.problem_id
+    AND NOT EXISTS (SELECT 1 FROM wanted w WHERE w.problem_id = r.problem_id AND w.related_id = r.related_id)
+)
+INSERT INTO problem_relations (problem_id, related_id)
+SELECT problem_id, related_id FROM wanted
+ON CONFLICT (problem_id, related_id) DO NOTHING
+`); err != nil {
+		return nil, fmt.Errorf("merge relations: %w", err)
 	}
 
-	// insert new tags
-	for _, t := range tags {
-		if _, err = tx.Exec(`
-			INSERT INTO problem_tags (problem_id, tag)
-			VALUES ($1, $2)
-			ON CONFLICT (problem_id, tag) DO NOTHING
-		`, problemID, t); err != nil {
-			return err
-		}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit batch: %w", err)
 	}
+	return diffs, nil
+}
 
-	return tx.Commit()
+// resolveSimilar decodes LeetCode's similarQuestions string and maps each slug to a problem id.
+// It returns the resolved ids and how many slugs are not present in our problems table.
+func resolveSimilar(raw string, slugToID map[string]int64) ([]int64, int) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, 0
+	}
+	var similar []similarQuestion
+	if err := json.Unmarshal([]byte(raw), &similar); err != nil {
+		log.Printf("warning: cannot decode similarQuestions %q: %v", raw, err)
+		return nil, 0
+	}
+	var ids []int64
+	unknown := 0
+	for _, sq := range similar {
+		id, ok := slugToID[sq.TitleSlug]
+		if !ok {
+			unknown++
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, unknown
 }
 
 // extractSlug extracts the LeetCode title slug from a problem URL.
@@ -250,6 +457,17 @@ func extractSlug(url string) string {
 	return strings.TrimSpace(s)
 }
 
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
 // tiny wrapper for ioutil.ReadAll since io/ioutil is deprecated in newer go versions
 func ioReadAll(r io.Reader) ([]byte, error) {
 	return io.ReadAll(r)
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// searchSorts maps the search sort names to ORDER BY clauses.
+var searchSorts = map[string]string{
+	"relevance":  "score DESC, frequency DESC NULLS LAST, id",
+	"frequency":  "frequency DESC NULLS LAST, score DESC, id",
+	"acceptance": "acceptance DESC NULLS LAST, score DESC, id",
+	"popularity": "popularity DESC NULLS LAST, score DESC, id",
+}
+
+// defaultMinSimilarity is the trigram word similarity a typo'd query needs to match.
+const defaultMinSimilarity = 0.4
+
+// searchQuery is a problem search: free text plus the usual problem filters.
+type searchQuery struct {
+	Text          string
+	Filter        problemFilter
+	Company       string // only problems asked by this company (case-insensitive)
+	Sort          string // a key of searchSorts; empty means relevance
+	Limit         int
+	Offset        int
+	MinSimilarity float64 // trigram threshold for typo matches, used as given (0 included)
+}
+
+type searchResult struct {
+	exportProblem
+	Tags  pq.StringArray `db:"tags" json:"tags"`
+	Score float64        `db:"score" json:"score"`
+}
+
+// searchProblems matches q.Text against problem_search: full-text on title, slug and tags,
+// or, for typos, trigram word similarity. Matches are ranked by the text rank plus the
+// similarity unless sorted otherwise. It returns one page and the total number of matches.
+func searchProblems(ctx context.Context, db *sqlx.DB, q searchQuery) ([]searchResult, int64, error) {
+	text := strings.TrimSpace(q.Text)
+	if text == "" {
+		return nil, 0, fmt.Errorf("empty search query")
+	}
+	sort := q.Sort
+	if sort == "" {
+		sort = "relevance"
+	}
+	order, ok := searchSorts[sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown sort %q (want relevance, frequency, acceptance or popularity)", sort)
+	}
+	var a sqlArgs
+	raw := a.add(text)
+	conds := problemFilterSQL(&q.Filter, &a, false)
+	if q.Company != "" {
+		conds = append(conds, `p.id IN (
+			SELECT cp.problem_id FROM company_problems cp JOIN companies c ON c.id = cp.company_id
+			WHERE lower(c.name) = lower(`+a.add(q.Company)+"::text))")
+	}
+	matches := fmt.Sprintf(`
+		WITH m AS (
+		  SELECT p.id, p.url, p.title, p.difficulty, p.acceptance, p.frequency, p.popularity, p.updated_at,
+		         ts_rank(s.document, websearch_to_tsquery('simple', %[1]s)) +
+		           word_similarity(lower(%[1]s), s.search_text) AS score
+		  FROM problem_search s
+		  JOIN problems p ON p.id = s.id
+		  WHERE (s.document @@ websearch_to_tsquery('simple', %[1]s) OR lower(%[1]s) <%% s.search_text)%[2]s
+		)`, raw+"::text", whereSQL(conds))
+
+	var results []searchResult
+	var total int64
+	err := inTx(ctx, db, func(tx *sqlx.Tx) error {
+		// <% matches when word_similarity exceeds this threshold
+		if _, err := tx.ExecContext(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)",
+			fmt.Sprint(q.MinSimilarity)); err != nil {
+			return err
+		}
+		paged := append(a[:len(a):len(a)], q.Limit, q.Offset)
+		if err := tx.SelectContext(ctx, &results, matches+fmt.Sprintf(`
+			SELECT m.*, ARRAY(SELECT tag FROM problem_tags WHERE problem_id = m.id ORDER BY tag) AS tags
+			FROM m
+			ORDER BY %s
+			LIMIT $%d OFFSET $%d`, order, len(a)+1, len(a)+2), paged...); err != nil {
+			return err
+		}
+		return tx.GetContext(ctx, &total, matches+" SELECT count(*) FROM m", a...)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// inTx runs fn in a transaction that is always rolled back; for reads that need SET LOCAL.
+func inTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// refreshSearchIndex rebuilds the problem_search materialized view after problems or
+// tags changed. CONCURRENTLY keeps it readable meanwhile (it needs the unique id index).
+func refreshSearchIndex(db *sqlx.DB) error {
+	_, err := db.Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY problem_search")
+	return err
+}
+
+// searchMain searches problems from the command line.
+// Usage: go run . search [-difficulty d] [-tag a,b] [-company c] [-timeframe t] [-sort s] [-limit n] words...
+//
+//	go run . search -refresh
+func searchMain(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	difficulty := fs.String("difficulty", "", "only problems of this difficulty")
+	tags := fs.String("tag", "", "comma-separated tags; problems must have all of them")
+	company := fs.String("company", "", "only problems asked by this company")
+	timeframe := fs.String("timeframe", "", "only problems asked in this timeframe (by any company)")
+	sort := fs.String("sort", "relevance", "relevance, frequency, acceptance or popularity")
+	limit := fs.Int("limit", 20, "number of results")
+	minSim := fs.Float64("similarity", defaultMinSimilarity, "minimum trigram word similarity for typo matches (0-1)")
+	refresh := fs.Bool("refresh", false, "rebuild the search index (problem_search) and exit")
+	fs.Parse(args)
+
+	godotenv.Load()
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer db.Close()
+
+	if *refresh {
+		if err := refreshSearchIndex(db); err != nil {
+			log.Fatalf("refresh search index: %v", err)
+		}
+		log.Println("search index refreshed")
+		return
+	}
+	if fs.NArg() == 0 {
+		log.Fatalf("usage: search [flags] words...")
+	}
+
+	q := searchQuery{
+		Text:          strings.Join(fs.Args(), " "),
+		Company:       *company,
+		Sort:          *sort,
+		Limit:         *limit,
+		MinSimilarity: *minSim,
+	}
+	if *difficulty != "" {
+		q.Filter.Difficulty = difficulty
+	}
+	if t := splitList(*tags); len(t) > 0 {
+		q.Filter.Tags = &t
+	}
+	if *timeframe != "" {
+		q.Filter.Timeframe = timeframe
+	}
+
+	results, total, err := searchProblems(context.Background(), db, q)
+	if err != nil {
+		log.Fatalf("search: %v", err)
+	}
+	for _, r := range results {
+		fmt.Printf("%5d  %-6s  %-50s  %.3f  %s\n", r.ID, derefString(r.Difficulty), derefString(r.Title), r.Score, strings.Join(r.Tags, ", "))
+	}
+	fmt.Printf("%d of %d matches\n", len(results), total)
+}
+
+// GET /search?q=&difficulty=&tag=&company=&timeframe=&sort=&limit=&offset=
+func (s *apiServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	limit, offset, err := pageParams(v.Get("limit"), v.Get("offset"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := searchQuery{Text: v.Get("q"), Company: v.Get("company"), Sort: v.Get("sort"), Limit: limit, Offset: offset,
+		MinSimilarity: defaultMinSimilarity}
+	if strings.TrimSpace(q.Text) == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if _, ok := searchSorts[q.Sort]; q.Sort != "" && !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown sort %q (want relevance, frequency, acceptance or popularity)", q.Sort))
+		return
+	}
+	if d := v.Get("difficulty"); d != "" {
+		q.Filter.Difficulty = &d
+	}
+	var tags []string
+	for _, t := range v["tag"] {
+		tags = append(tags, splitList(t)...)
+	}
+	if len(tags) > 0 {
+		q.Filter.Tags = &tags
+	}
+	if t := v.Get("timeframe"); t != "" {
+		q.Filter.Timeframe = &t
+	}
+
+	results, total, err := searchProblems(r.Context(), s.db, q)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	if results == nil {
+		results = []searchResult{}
+	}
+	writeJSON(w, http.StatusOK, apiPage{Items: results, Total: total, Limit: limit, Offset: offset})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// serialColumn is a serial or identity column found in the catalog.
+type serialColumn struct {
+	Table    string `db:"table_name"`
+	Column   string `db:"column_name"`
+	Sequence string `db:"sequence_name"`
+}
+
+// sequenceFix reports what fixSequences did to one sequence.
+type sequenceFix struct {
+	serialColumn
+	Before sql.NullInt64 // last value before the fix (NULL if never used)
+	After  sql.NullInt64 // last value after the fix (NULL if the table is empty)
+}
+
+func (f sequenceFix) String() string {
+	show := func(v sql.NullInt64) string {
+		if !v.Valid {
+			return "unset"
+		}
+		return fmt.Sprint(v.Int64)
+	}
+	if f.Before == f.After {
+		return fmt.Sprintf("%s.%s (%s): unchanged at %s", f.Table, f.Column, f.Sequence, show(f.After))
+	}
+	return fmt.Sprintf("%s.%s (%s): %s -> %s", f.Table, f.Column, f.Sequence, show(f.Before), show(f.After))
+}
+
+// serialColumns lists the columns of tables (in the current schema) that are backed by a
+// sequence, i.e. serial/bigserial columns and identity columns.
+func serialColumns(ctx context.Context, db sqlx.ExtContext, tables []string) ([]serialColumn, error) {
+	var cols []serialColumn
+	err := sqlx.SelectContext(ctx, db, &cols, `
+		SELECT table_name, column_name, sequence_name FROM (
+		  SELECT c.relname AS table_name, a.attname AS column_name,
+		         pg_get_serial_sequence(format('%I.%I', n.nspname, c.relname), a.attname) AS sequence_name,
+		         a.attnum
+		  FROM pg_attribute a
+		  JOIN pg_class c ON c.oid = a.attrelid
+		  JOIN pg_namespace n ON n.oid = c.relnamespace
+		  WHERE n.nspname = current_schema()
+		    AND c.relname = ANY($1)
+		    AND a.attnum > 0
+		    AND NOT a.attisdropped
+		) s
+		WHERE sequence_name IS NOT NULL
+		ORDER BY table_name, attnum
+	`, pq.Array(tables))
+	return cols, err
+}
+
+// fixSequences moves every sequence behind a serial or identity column of tables to the
+// column's current maximum, so inserts after a sync that copied explicit ids do not
+// collide. An empty table resets its sequence so the next value is 1.
+func fixSequences(ctx context.Context, db sqlx.ExtContext, tables []string) ([]sequenceFix, error) {
+	cols, err := serialColumns(ctx, db, tables)
+	if err != nil {
+		return nil, fmt.Errorf("find serial columns: %w", err)
+	}
+
+	var fixes []sequenceFix
+	for _, c := range cols {
+		fix := sequenceFix{serialColumn: c}
+
+		// pg_get_serial_sequence returns the name schema-qualified and already quoted where
+		// needed, so it can be used as a relation name as is (and as a regclass parameter)
+		var state struct {
+			LastValue int64 `db:"last_value"`
+			IsCalled  bool  `db:"is_called"`
+		}
+		if err := sqlx.GetContext(ctx, db, &state, fmt.Sprintf("SELECT last_value, is_called FROM %s", c.Sequence)); err != nil {
+			return fixes, fmt.Errorf("read %s: %w", c.Sequence, err)
+		}
+		if state.IsCalled {
+			fix.Before = sql.NullInt64{Int64: state.LastValue, Valid: true}
+		}
+
+		var max sql.NullInt64
+		if err := sqlx.GetContext(ctx, db, &max, fmt.Sprintf("SELECT MAX(%s) FROM %s",
+			pq.QuoteIdentifier(c.Column), pq.QuoteIdentifier(c.Table))); err != nil {
+			return fixes, fmt.Errorf("max %s.%s: %w", c.Table, c.Column, err)
+		}
+
+		// setval(seq, n, true) makes the next value n+1; setval(seq, 1, false) makes it 1
+		if max.Valid {
+			_, err = db.ExecContext(ctx, "SELECT setval($1::regclass, $2, true)", c.Sequence, max.Int64)
+		} else {
+			_, err = db.ExecContext(ctx, "SELECT setval($1::regclass, 1, false)", c.Sequence)
+		}
+		if err != nil {
+			return fixes, fmt.Errorf("fix sequence %s.%s: %w", c.Table, c.Column, err)
+		}
+		fix.After = max
+		fixes = append(fixes, fix)
+	}
+	return fixes, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema mirrors the local Postgres tables. Timestamps are stored as RFC 3339 text
+// in UTC, which sorts correctly and which Postgres parses back as is.
+const sqliteSchema = `
+CREATE TABLE companies (
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE problems (
+  id INTEGER PRIMARY KEY,
+  url TEXT,
+  title TEXT,
+  difficulty TEXT,
+  acceptance REAL,
+  frequency REAL,
+  popularity REAL,
+  updated_at TEXT
+);
+
+CREATE TABLE company_problems (
+  company_id INTEGER NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+  problem_id INTEGER NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  source_file TEXT,
+  timeframe_tag TEXT,
+  frequency REAL,
+  last_seen TEXT,
+  PRIMARY KEY (company_id, problem_id)
+);
+
+CREATE TABLE problem_tags (
+  problem_id INTEGER NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  added_at TEXT,
+  PRIMARY KEY (problem_id, tag)
+);
+
+CREATE TABLE problem_relations (
+  problem_id INTEGER NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  related_id INTEGER NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+  added_at TEXT,
+  PRIMARY KEY (problem_id, related_id)
+);
+
+CREATE TABLE company_similarity (
+  company_id INTEGER NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+  similar_id INTEGER NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+  method TEXT NOT NULL,
+  score REAL NOT NULL,
+  shared_problems INTEGER NOT NULL,
+  rank INTEGER NOT NULL,
+  computed_at TEXT,
+  PRIMARY KEY (company_id, similar_id, method)
+);
+
+CREATE TABLE company_stats (
+  company_id INTEGER PRIMARY KEY REFERENCES companies(id) ON DELETE CASCADE,
+  problem_count INTEGER NOT NULL,
+  by_difficulty TEXT NOT NULL, -- JSON
+  by_tag TEXT NOT NULL,
+  by_timeframe TEXT NOT NULL,
+  avg_acceptance REAL,
+  top_tags TEXT NOT NULL,
+  computed_at TEXT
+);
+
+CREATE INDEX idx_problems_title ON problems(title);
+CREATE INDEX idx_problems_popularity ON problems(popularity DESC);
+CREATE INDEX idx_company_problems_timeframe ON company_problems(timeframe_tag);
+CREATE INDEX idx_problem_relations_related ON problem_relations(related_id);
+CREATE INDEX idx_company_similarity_rank ON company_similarity(company_id, method, rank);
+
+CREATE VIEW unique_problem_tags AS
+SELECT DISTINCT tag
+FROM problem_tags
+ORDER BY tag;
+
+-- full-text search on titles: SELECT rowid FROM problems_fts WHERE problems_fts MATCH 'two sum'
+CREATE VIRTUAL TABLE problems_fts USING fts5(title, content='problems', content_rowid='id');
+`
+
+// offlineTables are the tables written to and read back from the SQLite file, parents
+// first. They are the pushed tables plus problem_relations, always copied in full.
+func offlineTables() []tableSpec {
+	specs := make([]tableSpec, 0, len(syncTables)+1)
+	for _, s := range syncTables {
+		s.Watermark = ""
+		specs = append(specs, s)
+	}
+	return append(specs, tableSpec{
+		Name:    "problem_relations",
+		Columns: []string{"problem_id", "related_id", "added_at"},
+		Key:     []string{"problem_id", "related_id"},
+	})
+}
+
+// sqliteMain builds an offline SQLite copy of the local db, or loads one back.
+// Usage: go run . sqlite export [-out visor.sqlite]
+//
+//	go run . sqlite import [-mirror] visor.sqlite
+func sqliteMain(args []string) {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		log.Fatalf("usage: sqlite export [-out file] | sqlite import [-mirror] file")
+	}
+	verb, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("sqlite "+verb, flag.ExitOnError)
+	out := fs.String("out", "visor.sqlite", "SQLite file to write (export)")
+	mirror := fs.Bool("mirror", false, "also delete local rows that are not in the file (import)")
+	maxDelete := fs.Int("max-delete", 1000, "with -mirror, refuse to delete more rows than this per table (-1 = no limit)")
+	fs.Parse(args)
+
+	godotenv.Load()
+	dsn := os.Getenv("LOCAL_DATABASE_URL")
+	if dsn == "" {
+		log.Fatalf("LOCAL_DATABASE_URL environment variable is required")
+	}
+	pg, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
+	defer pg.Close()
+
+	ctx := context.Background()
+	if verb == "export" {
+		if err := exportSQLite(ctx, pg, *out); err != nil {
+			log.Fatalf("sqlite export: %v", err)
+		}
+		log.Printf("wrote %s", *out)
+		return
+	}
+
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: sqlite import [-mirror] file")
+	}
+	opts := syncOptions{Mirror: *mirror, Full: true, Atomic: true, MaxDelete: *maxDelete}
+	if err := importSQLite(ctx, fs.Arg(0), pg, opts); err != nil {
+		log.Fatalf("sqlite import: %v", err)
+	}
+	log.Printf("imported %s", fs.Arg(0))
+}
+
+// exportSQLite writes the offline tables of pg into a new SQLite file at path. The file
+// is built next to path and renamed into place, so a failed export leaves no partial file.
+func exportSQLite(ctx context.Context, pg *sqlx.DB, path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+
+	lite, err := sqlx.Connect("sqlite", tmp)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", tmp, err)
+	}
+	defer lite.Close()
+
+	tx, err := lite.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, sqliteSchema); err != nil {
+		return fmt.Errorf("create schema: %w", err)
+	}
+	for _, spec := range offlineTables() {
+		n, err := copyToSQLite(ctx, pg, tx, spec)
+		if err != nil {
+			return fmt.Errorf("copy %s: %w", spec.Name, err)
+		}
+		log.Printf("%s: %d rows", spec.Name, n)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO problems_fts(problems_fts) VALUES ('rebuild')"); err != nil {
+		return fmt.Errorf("build problems_fts: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if _, err := lite.ExecContext(ctx, "VACUUM"); err != nil {
+		return err
+	}
+	if err := lite.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyToSQLite inserts every row of spec's table from pg into the SQLite transaction.
+func copyToSQLite(ctx context.Context, pg *sqlx.DB, tx *sqlx.Tx, spec tableSpec) (int, error) {
+	cols := quoteIdents(spec.Columns)
+	table := pq.QuoteIdentifier(spec.Name)
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, cols, strings.TrimSuffix(strings.Repeat("?, ", len(spec.Columns)), ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	rows, err := pg.QueryxContext(ctx, fmt.Sprintf("SELECT %s FROM %s", cols, table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	vals := make([]interface{}, len(spec.Columns))
+	ptrs := make([]interface{}, len(spec.Columns))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	var n int
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		for i, v := range vals {
+			switch v := v.(type) {
+			case []byte:
+				vals[i] = string(v)
+			case time.Time:
+				vals[i] = v.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, vals...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// importSQLite loads an offline SQLite file back into pg with the sync engine, in one
+// transaction and in foreign key order, then fixes the sequences of the loaded tables.
+func importSQLite(ctx context.Context, path string, pg *sqlx.DB, opts syncOptions) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	lite, err := sqlx.Connect("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer lite.Close()
+
+	specs := offlineTables()
+	names := make([]string, len(specs))
+	for i, s := range specs {
+		names[i] = s.Name
+	}
+	fks, err := foreignKeys(ctx, pg, names)
+	if err != nil {
+		return fmt.Errorf("read foreign keys: %w", err)
+	}
+	if specs, err = orderByForeignKeys(specs, fks); err != nil {
+		return err
+	}
+
+	tx, err := pg.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, spec := range specs {
+		if err := syncTable(ctx, lite, tx, spec, opts); err != nil {
+			return err
+		}
+	}
+	fixes, err := fixSequences(ctx, tx, names)
+	if err != nil {
+		return err
+	}
+	logSequenceFixes(fixes)
+	return tx.Commit()
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// tableSpec declares how a table is synced between two databases with the same schema.
+type tableSpec struct {
+	Name    string   // destination table
+	Source  string   // source table, when it differs from Name
+	Columns []string // copied columns, in order
+	Select  []string // source column for each of Columns, when they differ
+	Key     []string // conflict key (primary key) used by the upsert and the mirror deletes
+	Update  []string // columns overwritten on conflict; empty means ON CONFLICT DO NOTHING
+	// Watermark is a timestamp column bumped on every change; when set, only rows at or past
+	// the destination's high-water mark are copied. Empty means always copy in full.
+	Watermark string
+	// Replace lists partition columns for tables that are rebuilt a partition at a time:
+	// the destination rows of every partition present in the copied rows are deleted
+	// before the insert, so rows the source dropped from a rebuilt partition go too.
+	Replace []string
+	// Transform rewrites a row (in Columns order) after it is read and before it is copied.
+	Transform func(row []interface{}) error
+}
+
+// sourceTable is the table rows are read from.
+func (spec tableSpec) sourceTable() string {
+	if spec.Source != "" {
+		return spec.Source
+	}
+	return spec.Name
+}
+
+// sourceColumns are the columns read from the source, matching Columns one to one.
+func (spec tableSpec) sourceColumns() []string {
+	if len(spec.Select) > 0 {
+		return spec.Select
+	}
+	return spec.Columns
+}
+
+// syncTable copies spec's rows from src into dst: COPY into a temp table shaped like the
+// destination table, upsert from it, optionally delete rows absent from it (mirror) and
+// advance the watermark. It runs in dst's transaction and does not commit.
+func syncTable(ctx context.Context, src *sqlx.DB, dst *sqlx.Tx, spec tableSpec, opts syncOptions) error {
+	table := pq.QuoteIdentifier(spec.Name)
+	temp := "temp_" + spec.Name
+	cols := quoteIdents(spec.Columns)
+
+	// the temp table takes its column types from the destination table (dropped at commit)
+	if _, err := dst.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+		pq.QuoteIdentifier(temp), cols, table)); err != nil {
+		return fmt.Errorf("create %s: %w", temp, err)
+	}
+
+	// delta: only rows changed since the last synced high-water mark
+	// (looked up before COPY starts, the connection is busy until it ends)
+	srcCols := spec.sourceColumns()
+	if len(srcCols) != len(spec.Columns) {
+		return fmt.Errorf("%s: %d source columns for %d columns", spec.Name, len(srcCols), len(spec.Columns))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", quoteIdents(srcCols), pq.QuoteIdentifier(spec.sourceTable()))
+	var queryArgs []interface{}
+	wmIdx := -1
+	if spec.Watermark != "" {
+		for i, c := range spec.Columns {
+			if c == spec.Watermark {
+				wmIdx = i
+			}
+		}
+		if wmIdx < 0 {
+			return fmt.Errorf("%s: watermark column %s is not synced", spec.Name, spec.Watermark)
+		}
+		since, err := deltaSince(ctx, dst, spec.Name, opts)
+		if err != nil {
+			return err
+		}
+		if since != nil {
+			query += fmt.Sprintf(" WHERE %s >= $1", pq.QuoteIdentifier(srcCols[wmIdx]))
+			queryArgs = append(queryArgs, *since)
+		}
+	}
+	var highWater time.Time
+
+	stmt, err := dst.Prepare(pq.CopyIn(temp, spec.Columns...))
+	if err != nil {
+		return fmt.Errorf("prepare copyin %s: %w", spec.Name, err)
+	}
+
+	rows, err := src.QueryxContext(ctx, query, queryArgs...)
+	if err != nil {
+		stmt.Close()
+		return fmt.Errorf("select source %s: %w", spec.Name, err)
+	}
+	defer rows.Close()
+
+	// values come back as driver values (nil for NULL), which COPY accepts as they are
+	vals := make([]interface{}, len(spec.Columns))
+	ptrs := make([]interface{}, len(spec.Columns))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+
+	var count int
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			stmt.Close()
+			return fmt.Errorf("scan %s: %w", spec.Name, err)
+		}
+		for i, v := range vals {
+			// types the driver does not decode (uuid, numeric, ...) come back as raw text;
+			// COPY would encode []byte as bytea, so pass them on as strings
+			if b, ok := v.([]byte); ok {
+				vals[i] = string(b)
+			}
+		}
+		if spec.Transform != nil {
+			if err := spec.Transform(vals); err != nil {
+				stmt.Close()
+				return fmt.Errorf("transform %s row: %w", spec.Name, err)
+			}
+		}
+		if _, err := stmt.Exec(vals...); err != nil {
+			stmt.Close()
+			return fmt.Errorf("copy exec %s: %w", spec.Name, err)
+		}
+		if wmIdx >= 0 {
+			if t, ok := vals[wmIdx].(time.Time); ok && t.After(highWater) {
+				highWater = t
+			}
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		stmt.Close()
+		return fmt.Errorf("read source %s: %w", spec.Name, err)
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return fmt.Errorf("final copy exec %s: %w", spec.Name, err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("close copy stmt %s: %w", spec.Name, err)
+	}
+
+	replaced, err := replacePartitions(ctx, dst, spec.Name, temp, spec.Replace)
+	if err != nil {
+		return err
+	}
+
+	// Upsert from temp into real table
+	if _, err := dst.ExecContext(ctx, upsertQuery(spec)); err != nil {
+		return fmt.Errorf("upsert %s: %w", spec.Name, err)
+	}
+
+	deleted, cascaded, err := mirrorDeletes(ctx, dst, spec.Name, temp, spec.Key, opts)
+	if err != nil {
+		return err
+	}
+
+	if wmIdx >= 0 && savesWatermark(opts, count) {
+		if err := saveWatermark(ctx, dst, spec.Name, spec.Watermark, highWater); err != nil {
+			return err
+		}
+	}
+
+	msg := fmt.Sprintf("%s staged: %d copied", spec.Name, count)
+	if len(spec.Replace) > 0 {
+		msg += fmt.Sprintf(", %d replaced", replaced)
+	}
+	msg += fmt.Sprintf(", %d deleted", deleted)
+	if n := sumCounts(cascaded); n > 0 {
+		msg += fmt.Sprintf(" (+%d by cascade: %s)", n, formatCounts(cascaded))
+	}
+	log.Println(msg)
+	return nil
+}
+
+// upsertQuery builds INSERT ... SELECT FROM temp ... ON CONFLICT for spec.
+func upsertQuery(spec tableSpec) string {
+	cols := quoteIdents(spec.Columns)
+	q := fmt.Sprintf("INSERT INTO %s (%s)\nSELECT %s FROM %s\nON CONFLICT (%s) ",
+		pq.QuoteIdentifier(spec.Name), cols, cols,
+		pq.QuoteIdentifier("temp_"+spec.Name), quoteIdents(spec.Key))
+	if len(spec.Update) == 0 {
+		return q + "DO NOTHING"
+	}
+	sets := make([]string, len(spec.Update))
+	for i, c := range spec.Update {
+		c = pq.QuoteIdentifier(c)
+		sets[i] = fmt.Sprintf("%s = EXCLUDED.%s", c, c)
+	}
+	return q + "DO UPDATE\n  SET " + strings.Join(sets, ",\n      ")
+}
+
+// quoteIdents quotes and comma-joins column names.
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = pq.QuoteIdentifier(n)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// deltaSince returns the watermark rows of table must reach to be copied, or nil for a
+// full copy (-full, -mirror which needs every key, no sync_watermarks table, or no
+// watermark recorded yet). Rows equal to the watermark are copied again, which is
+// harmless with the upserts and keeps rows committed with the same timestamp from being missed.
+func deltaSince(ctx context.Context, tx sqlx.QueryerContext, table string, opts syncOptions) (*time.Time, error) {
+	if !readsWatermark(opts) {
+		return nil, nil
+	}
+	var hw sql.NullTime
+	err := sqlx.GetContext(ctx, tx, &hw, "SELECT high_water FROM sync_watermarks WHERE table_name = $1", table)
+	if err == sql.ErrNoRows || (err == nil && !hw.Valid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load %s watermark: %w", table, err)
+	}
+	log.Printf("%s: copying rows changed since %s", table, hw.Time.Format(time.RFC3339))
+	return &hw.Time, nil
+}
+
+// readsWatermark reports whether tables are copied from their stored watermark under opts.
+func readsWatermark(opts syncOptions) bool {
+	return !opts.Full && !opts.Mirror && !opts.NoWatermarks
+}
+
+// savesWatermark reports whether a table that copied count rows records its new
+// watermark. A -full or -mirror copy does too: it re-establishes the high-water mark.
+func savesWatermark(opts syncOptions, count int) bool {
+	return count > 0 && !opts.NoWatermarks
+}
+
+// watermarkOptions adapts opts to whether the destination has the sync_watermarks table:
+// without it every table is copied in full and no watermark is written, and the
+// returned warning says so.
+func watermarkOptions(hasTable bool, opts syncOptions) (syncOptions, string) {
+	if hasTable {
+		return opts, ""
+	}
+	opts.NoWatermarks = true
+	return opts, `the destination has no sync_watermarks table (see "Sync to Supabase" in db/docs.md); copying every table in full`
+}
+
+// hasSyncWatermarks reports whether db has the sync_watermarks table delta syncs need.
+func hasSyncWatermarks(ctx context.Context, db *sqlx.DB) (bool, error) {
+	var ok bool
+	err := db.GetContext(ctx, &ok, "SELECT to_regclass('sync_watermarks') IS NOT NULL")
+	return ok, err
+}
+
+// saveWatermark records the newest timestamp copied for table. It runs in the sync
+// transaction, so the watermark only moves when the rows are committed.
+func saveWatermark(ctx context.Context, tx *sqlx.Tx, table, column string, highWater time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO sync_watermarks (table_name, column_name, high_water, synced_at)
+	VALUES ($1, $2, $3, now())
+	ON CONFLICT (table_name) DO UPDATE
+	  SET column_name = EXCLUDED.column_name,
+	      high_water = GREATEST(sync_watermarks.high_water, EXCLUDED.high_water),
+	      synced_at = now();
+	`, table, column, highWater)
+	if err != nil {
+		return fmt.Errorf("save %s watermark: %w", table, err)
+	}
+	return nil
+}
+
+// syncTableTx runs one table's sync in its own destination transaction.
+func syncTableTx(ctx context.Context, src, dst *sqlx.DB, spec tableSpec, opts syncOptions) error {
+	tx, err := dst.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := syncTable(ctx, src, tx, spec, opts); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// replacePartitions deletes the rows of table in every partition (by cols) that occurs in
+// temp, in the sync's transaction, ahead of the insert that refills them. These are
+// replacements, so -max-delete does not apply to them.
+func replacePartitions(ctx context.Context, tx *sqlx.Tx, table, temp string, cols []string) (int64, error) {
+	if len(cols) == 0 {
+		return 0, nil
+	}
+	conds := make([]string, len(cols))
+	for i, c := range cols {
+		c = pq.QuoteIdentifier(c)
+		conds[i] = fmt.Sprintf("x.%s = t.%s", c, c)
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s t WHERE EXISTS (SELECT 1 FROM %s x WHERE %s)",
+		pq.QuoteIdentifier(table), pq.QuoteIdentifier(temp), strings.Join(conds, " AND ")))
+	if err != nil {
+		return 0, fmt.Errorf("replace %s partitions: %w", table, err)
+	}
+	return res.RowsAffected()
+}
+
+// mirrorDeletes removes rows of table whose key is not in the freshly copied temp table.
+// It always counts first, including the rows ON DELETE CASCADE would take along in other
+// tables; nothing is deleted unless opts.Mirror is set and all of them together are within
+// opts.MaxDelete. In dry-run mode it only returns the counts.
+func mirrorDeletes(ctx context.Context, tx *sqlx.Tx, table, temp string, keys []string, opts syncOptions) (int64, map[string]int64, error) {
+	if !opts.Mirror {
+		return 0, nil, nil
+	}
+
+	conds := make([]string, len(keys))
+	for i, k := range keys {
+		k = pq.QuoteIdentifier(k)
+		conds[i] = fmt.Sprintf("x.%s = t.%s", k, k)
+	}
+	absent := fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s x WHERE %s)",
+		pq.QuoteIdentifier(temp), strings.Join(conds, " AND "))
+
+	var n int64
+	if err := tx.GetContext(ctx, &n, fmt.Sprintf("SELECT count(*) FROM %s t WHERE %s", pq.QuoteIdentifier(table), absent)); err != nil {
+		return 0, nil, fmt.Errorf("count %s deletions: %w", table, err)
+	}
+	if n == 0 {
+		return 0, nil, nil
+	}
+	cascaded := map[string]int64{}
+	doomed := fmt.Sprintf("SELECT t.* FROM %s t WHERE %s", pq.QuoteIdentifier(table), absent)
+	if err := countCascade(ctx, tx, table, doomed, map[string]bool{table: true}, cascaded); err != nil {
+		return 0, nil, fmt.Errorf("count %s cascade: %w", table, err)
+	}
+	if err := checkDeleteCap(table, n, cascaded, opts.MaxDelete); err != nil {
+		return n, cascaded, err
+	}
+	if opts.DryRun {
+		return n, cascaded, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s t WHERE %s", pq.QuoteIdentifier(table), absent)); err != nil {
+		return 0, nil, fmt.Errorf("delete from %s: %w", table, err)
+	}
+	return n, cascaded, nil
+}
+
+// countCascade adds to counts, per table, the rows that deleting the rows of table
+// selected by doomed would remove through ON DELETE CASCADE, following the cascade down.
+// Tables already on the path (self-references, cycles) are not followed again, and rows
+// reached along two paths count twice, which only makes the cap stricter.
+func countCascade(ctx context.Context, tx *sqlx.Tx, table, doomed string, path map[string]bool, counts map[string]int64) error {
+	fks, err := cascadingForeignKeys(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+	// a child may reference table more than once (problem_relations): one condition each
+	byChild := map[string][]string{}
+	var children []string
+	for _, fk := range fks {
+		if path[fk.Child] {
+			continue
+		}
+		match := make([]string, len(fk.ChildColumns))
+		for i := range fk.ChildColumns {
+			match[i] = fmt.Sprintf("c.%s = d.%s", pq.QuoteIdentifier(fk.ChildColumns[i]), pq.QuoteIdentifier(fk.ParentColumns[i]))
+		}
+		if byChild[fk.Child] == nil {
+			children = append(children, fk.Child)
+		}
+		byChild[fk.Child] = append(byChild[fk.Child], "("+strings.Join(match, " AND ")+")")
+	}
+
+	for _, child := range children {
+		childDoomed := fmt.Sprintf("SELECT c.* FROM %s c WHERE EXISTS (SELECT 1 FROM (%s) d WHERE %s)",
+			pq.QuoteIdentifier(child), doomed, strings.Join(byChild[child], " OR "))
+		var n int64
+		if err := tx.GetContext(ctx, &n, "SELECT count(*) FROM ("+childDoomed+") c"); err != nil {
+			return fmt.Errorf("count %s: %w", child, err)
+		}
+		if n == 0 {
+			continue
+		}
+		counts[child] += n
+		path[child] = true
+		err := countCascade(ctx, tx, child, childDoomed, path, counts)
+		delete(path, child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDeleteCap fails when deleting n rows of table, plus the rows cascaded to other
+// tables, would remove more than maxDelete rows in all (-1 = no limit).
+func checkDeleteCap(table string, n int64, cascaded map[string]int64, maxDelete int) error {
+	total := n + sumCounts(cascaded)
+	if maxDelete < 0 || total <= int64(maxDelete) {
+		return nil
+	}
+	if len(cascaded) == 0 {
+		return fmt.Errorf("mirror would delete %d rows from %s, more than -max-delete %d", n, table, maxDelete)
+	}
+	return fmt.Errorf("mirror would delete %d rows from %s and %d more by cascade (%s), %d in all, more than -max-delete %d",
+		n, table, total-n, formatCounts(cascaded), total, maxDelete)
+}
+
+func sumCounts(counts map[string]int64) int64 {
+	var n int64
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+// formatCounts renders counts as "table n, table n" by table name.
+func formatCounts(counts map[string]int64) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUpsertQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		spec tableSpec
+		want string
+	}{
+		{
+			name: "update",
+			spec: tableSpec{Name: "problems", Columns: []string{"id", "title", "updated_at"}, Key: []string{"id"}, Update: []string{"title", "updated_at"}},
+			want: `INSERT INTO "problems" ("id", "title", "updated_at")
+SELECT "id", "title", "updated_at" FROM "temp_problems"
+ON CONFLICT ("id") DO UPDATE
+  SET "title" = EXCLUDED."title",
+      "updated_at" = EXCLUDED."updated_at"`,
+		},
+		{
+			name: "no update columns",
+			spec: tableSpec{Name: "problem_reviews", Columns: []string{"user_hash", "problem_id"}, Key: []string{"user_hash", "problem_id"}},
+			want: `INSERT INTO "problem_reviews" ("user_hash", "problem_id")
+SELECT "user_hash", "problem_id" FROM "temp_problem_reviews"
+ON CONFLICT ("user_hash", "problem_id") DO NOTHING`,
+		},
+		{
+			name: "quoted identifiers",
+			spec: tableSpec{Name: `we"ird`, Columns: []string{"order"}, Key: []string{"order"}, Update: []string{"order"}},
+			want: `INSERT INTO "we""ird" ("order")
+SELECT "order" FROM "temp_we""ird"
+ON CONFLICT ("order") DO UPDATE
+  SET "order" = EXCLUDED."order"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upsertQuery(tt.spec); got != tt.want {
+				t.Errorf("upsertQuery =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatermarkOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		hasTable  bool
+		opts      syncOptions
+		wantRead  bool
+		wantSave  bool
+		wantWarns bool
+	}{
+		{name: "delta", hasTable: true, wantRead: true, wantSave: true},
+		{name: "full re-establishes the watermark", hasTable: true, opts: syncOptions{Full: true}, wantSave: true},
+		{name: "mirror needs every key", hasTable: true, opts: syncOptions{Mirror: true}, wantSave: true},
+		{name: "no sync_watermarks table", wantWarns: true},
+		{name: "no sync_watermarks table with -full", opts: syncOptions{Full: true}, wantWarns: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, warning := watermarkOptions(tt.hasTable, tt.opts)
+			if (warning != "") != tt.wantWarns {
+				t.Errorf("warning = %q, want one: %v", warning, tt.wantWarns)
+			}
+			if got := readsWatermark(opts); got != tt.wantRead {
+				t.Errorf("readsWatermark = %v, want %v", got, tt.wantRead)
+			}
+			if got := savesWatermark(opts, 10); got != tt.wantSave {
+				t.Errorf("savesWatermark = %v, want %v", got, tt.wantSave)
+			}
+			if savesWatermark(opts, 0) {
+				t.Error("savesWatermark with nothing copied")
+			}
+		})
+	}
+}
+
+func TestDeltaSince(t *testing.T) {
+	db := testPostgres(t)
+	ctx := context.Background()
+
+	if ok, err := hasSyncWatermarks(ctx, db); err != nil || ok {
+		t.Fatalf("hasSyncWatermarks before the migration = %v, %v; want false", ok, err)
+	}
+	opts, _ := watermarkOptions(false, syncOptions{})
+	if got, err := deltaSince(ctx, db, "problems", opts); err != nil || got != nil {
+		t.Fatalf("deltaSince without sync_watermarks = %v, %v; want a full copy", got, err)
+	}
+
+	hw := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	db.MustExec(`
+		CREATE TABLE sync_watermarks (
+		  table_name TEXT PRIMARY KEY,
+		  column_name TEXT NOT NULL,
+		  high_water TIMESTAMP WITH TIME ZONE,
+		  synced_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+		)`)
+	db.MustExec(`INSERT INTO sync_watermarks (table_name, column_name, high_water)
+		VALUES ('problems', 'updated_at', $1), ('problem_tags', 'added_at', NULL)`, hw)
+	if ok, err := hasSyncWatermarks(ctx, db); err != nil || !ok {
+		t.Fatalf("hasSyncWatermarks after the migration = %v, %v; want true", ok, err)
+	}
+
+	tests := []struct {
+		name  string
+		table string
+		opts  syncOptions
+		want  *time.Time
+	}{
+		{name: "delta", table: "problems", want: &hw},
+		{name: "full", table: "problems", opts: syncOptions{Full: true}},
+		{name: "never synced", table: "company_problems"},
+		{name: "null watermark", table: "problem_tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := deltaSince(ctx, db, tt.table, tt.opts)
+			if err != nil {
+				t.Fatalf("deltaSince: %v", err)
+			}
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("deltaSince = %v, want a full copy", *got)
+			case tt.want != nil && (got == nil || !got.Equal(*tt.want)):
+				t.Errorf("deltaSince = %v, want %v", got, *tt.want)
+			}
+		})
+	}
+}
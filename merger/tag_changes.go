@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// tagDiff is what writeScrapedBatch changed in the tags of one problem.
+type tagDiff struct {
+	Added   []string
+	Removed []string
+}
+
+// startTagRun registers a new tag scrape run and returns its id.
+func startTagRun(db *sqlx.DB) (int64, error) {
+	var id int64
+	err := db.Get(&id, "INSERT INTO tag_scrape_runs DEFAULT VALUES RETURNING id")
+	return id, err
+}
+
+// tagRun is a row of tag_scrape_runs.
+type tagRun struct {
+	ID            int64         `db:"id"`
+	LastProblemID sql.NullInt64 `db:"last_problem_id"`
+}
+
+// lastUnfinishedTagRun returns the most recent run that never finished, or nil.
+func lastUnfinishedTagRun(db *sqlx.DB) (*tagRun, error) {
+	var run tagRun
+	err := db.Get(&run, `
+		SELECT id, last_problem_id FROM tag_scrape_runs
+		WHERE finished_at IS NULL
+		ORDER BY id DESC
+		LIMIT 1
+	`)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// checkpointTagRun records that every problem up to lastProblemID is done.
+func checkpointTagRun(db *sqlx.DB, runID, lastProblemID int64) error {
+	_, err := db.Exec(`
+		UPDATE tag_scrape_runs SET last_problem_id = $2, checkpoint_at = now()
+		WHERE id = $1
+	`, runID, lastProblemID)
+	return err
+}
+
+// finishTagRun stamps the run as finished.
+func finishTagRun(db *sqlx.DB, runID int64) error {
+	_, err := db.Exec("UPDATE tag_scrape_runs SET finished_at = now() WHERE id = $1", runID)
+	return err
+}
+
+// tagChangeSummary accumulates the diffs of a run for the end-of-run report.
+type tagChangeSummary struct {
+	problems int // problems with at least one change
+	added    map[string]int
+	removed  map[string]int
+}
+
+func newTagChangeSummary() *tagChangeSummary {
+	return &tagChangeSummary{added: map[string]int{}, removed: map[string]int{}}
+}
+
+func (s *tagChangeSummary) add(d tagDiff) {
+	if len(d.Added) == 0 && len(d.Removed) == 0 {
+		return
+	}
+	s.problems++
+	for _, t := range d.Added {
+		s.added[t]++
+	}
+	for _, t := range d.Removed {
+		s.removed[t]++
+	}
+}
+
+func (s *tagChangeSummary) print(runID int64) {
+	total := func(m map[string]int) int {
+		n := 0
+		for _, c := range m {
+			n += c
+		}
+		return n
+	}
+	log.Printf("run %d: %d problems changed, %d tags added, %d tags removed",
+		runID, s.problems, total(s.added), total(s.removed))
+	if len(s.added) > 0 {
+		log.Printf("  added:   %s", formatTagCounts(s.added))
+	}
+	if len(s.removed) > 0 {
+		log.Printf("  removed: %s", formatTagCounts(s.removed))
+	}
+}
+
+// formatTagCounts renders "Tag (n), ..." ordered by count, then name.
+func formatTagCounts(m map[string]int) string {
+	tags := make([]string, 0, len(m))
+	for t := range m {
+		tags = append(tags, t)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if m[tags[i]] != m[tags[j]] {
+			return m[tags[i]] > m[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	parts := make([]string, len(tags))
+	for i, t := range tags {
+		parts[i] = fmt.Sprintf("%s (%d)", t, m[t])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// progress tracks how much of a run is done and estimates the time left.
+type progress struct {
+	total   int
+	done    int
+	started time.Time
+}
+
+func newProgress(total int) *progress {
+	return &progress{total: total, started: time.Now()}
+}
+
+func (p *progress) advance(n int) {
+	p.done += n
+}
+
+// String renders "done/total, ETA 3m20s" (ETA is unknown until the first batch is done).
+func (p *progress) String() string {
+	if p.done == 0 {
+		return fmt.Sprintf("%d/%d, ETA unknown", p.done, p.total)
+	}
+	elapsed := time.Since(p.started)
+	left := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+	return fmt.Sprintf("%d/%d, ETA %s", p.done, p.total, left.Round(time.Second))
+}
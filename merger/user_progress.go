@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// userProgressSpec pulls Supabase's user_completed_problems into the local user_progress
+// table. User ids never leave the sync: each one is replaced by an HMAC keyed with salt,
+// so the same user always maps to the same hash but the hash cannot be reversed.
+func userProgressSpec(salt string) tableSpec {
+	return tableSpec{
+		Name:      "user_progress",
+		Source:    "user_completed_problems",
+		Columns:   []string{"user_hash", "problem_id", "completed_at"},
+		Select:    []string{"user_id", "problem_id", "completed_at"},
+		Key:       []string{"user_hash", "problem_id"},
+		Update:    []string{"completed_at"},
+		Watermark: "completed_at",
+		Transform: hashFirstColumn(salt),
+	}
+}
+
+// hashFirstColumn is a Transform replacing a pulled row's first column, the user id,
+// with its hashUserID.
+func hashFirstColumn(salt string) func(row []interface{}) error {
+	return func(row []interface{}) error {
+		id, ok := row[0].(string)
+		if !ok {
+			return fmt.Errorf("unexpected user_id %T", row[0])
+		}
+		row[0] = hashUserID(salt, id)
+		return nil
+	}
+}
+
+// hashUserID returns the hex HMAC-SHA256 of a user id.
+func hashUserID(salt, userID string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
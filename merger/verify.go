@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// bucketSummary is the row count and content hash of one primary key range.
+type bucketSummary struct {
+	Bucket int64  `db:"bucket"`
+	Rows   int64  `db:"row_count"`
+	Hash   string `db:"hash"`
+}
+
+// rowHash is the hash of a single row, keyed by its primary key as text.
+type rowHash struct {
+	Key  string `db:"key"`
+	Hash string `db:"hash"`
+}
+
+// verifyMain compares every synced table between the local db and Supabase.
+// Usage: go run . verify [-bucket N] [-table name] [-max-keys N]
+func verifyMain(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	bucketWidth := fs.Int64("bucket", 1000, "width of the primary key ranges that are hashed together")
+	only := fs.String("table", "", "verify only this table")
+	maxKeys := fs.Int("max-keys", 50, "print at most this many differing keys per table")
+	fs.Parse(args)
+	if *bucketWidth <= 0 {
+		log.Fatalf("-bucket must be > 0")
+	}
+
+	godotenv.Load()
+	localDSN = os.Getenv("LOCAL_DATABASE_URL")
+	remoteDSN = os.Getenv("SUPABASE_DATABASE_URL")
+	if localDSN == "" || remoteDSN == "" {
+		log.Fatal("set LOCAL_DATABASE_URL and SUPABASE_DATABASE_URL env vars")
+	}
+
+	local, err := sqlx.Connect("postgres", localDSN)
+	if err != nil {
+		log.Fatalf("connect local: %v", err)
+	}
+	defer local.Close()
+
+	remote, err := sqlx.Connect("postgres", remoteDSN)
+	if err != nil {
+		log.Fatalf("connect remote: %v", err)
+	}
+	defer remote.Close()
+
+	ctx := context.Background()
+	drift := false
+	for _, spec := range syncTables {
+		if *only != "" && spec.Name != *only {
+			continue
+		}
+		ok, err := verifyTable(ctx, local, remote, spec, *bucketWidth, *maxKeys)
+		if err != nil {
+			log.Fatalf("verify %s: %v", spec.Name, err)
+		}
+		drift = drift || !ok
+	}
+
+	if drift {
+		log.Println("verify: local and remote differ")
+		os.Exit(1)
+	}
+	log.Println("verify: local and remote match")
+}
+
+// verifyTable compares one table bucket by bucket and, for buckets that differ,
+// row by row. It returns false when the two sides differ.
+func verifyTable(ctx context.Context, local, remote *sqlx.DB, spec tableSpec, width int64, maxKeys int) (bool, error) {
+	lb, err := tableBuckets(ctx, local, spec, width)
+	if err != nil {
+		return false, fmt.Errorf("local: %w", err)
+	}
+	rb, err := tableBuckets(ctx, remote, spec, width)
+	if err != nil {
+		return false, fmt.Errorf("remote: %w", err)
+	}
+
+	var localRows, remoteRows int64
+	var differing []int64
+	for b, l := range lb {
+		localRows += l.Rows
+		if r, ok := rb[b]; !ok || r.Hash != l.Hash {
+			differing = append(differing, b)
+		}
+	}
+	for b, r := range rb {
+		remoteRows += r.Rows
+		if _, ok := lb[b]; !ok {
+			differing = append(differing, b)
+		}
+	}
+	sort.Slice(differing, func(i, j int) bool { return differing[i] < differing[j] })
+
+	if len(differing) == 0 {
+		log.Printf("%s: OK (%d rows, %d buckets)", spec.Name, localRows, len(lb))
+		return true, nil
+	}
+	log.Printf("%s: DIFFERS — local %d rows, remote %d rows, %d of %d buckets differ",
+		spec.Name, localRows, remoteRows, len(differing), len(lb))
+
+	printed := 0
+	for _, b := range differing {
+		lr, err := bucketRows(ctx, local, spec, width, b)
+		if err != nil {
+			return false, fmt.Errorf("local bucket %d: %w", b, err)
+		}
+		rr, err := bucketRows(ctx, remote, spec, width, b)
+		if err != nil {
+			return false, fmt.Errorf("remote bucket %d: %w", b, err)
+		}
+		for _, d := range diffRowHashes(lr, rr) {
+			if printed == maxKeys {
+				log.Printf("  ... more differing keys not shown (-max-keys %d)", maxKeys)
+				return false, nil
+			}
+			log.Printf("  %s %s", spec.Name, d)
+			printed++
+		}
+	}
+	return false, nil
+}
+
+// diffRowHashes lists the keys that are missing on either side or hash differently.
+func diffRowHashes(local, remote []rowHash) []string {
+	rm := make(map[string]string, len(remote))
+	for _, r := range remote {
+		rm[r.Key] = r.Hash
+	}
+	var out []string
+	for _, l := range local {
+		h, ok := rm[l.Key]
+		switch {
+		case !ok:
+			out = append(out, l.Key+": missing on remote")
+		case h != l.Hash:
+			out = append(out, l.Key+": content differs")
+		}
+		delete(rm, l.Key)
+	}
+	var extra []string
+	for k := range rm {
+		extra = append(extra, k+": only on remote")
+	}
+	sort.Strings(extra)
+	return append(out, extra...)
+}
+
+// bucketExpr is the primary key range a row falls into (by its first key column).
+func bucketExpr(spec tableSpec) string {
+	return fmt.Sprintf("(%s)::bigint / $1", pq.QuoteIdentifier(spec.Key[0]))
+}
+
+// rowTextExprs returns the key and whole-row text expressions hashed by verify.
+func rowTextExprs(spec tableSpec) (key, row string) {
+	keys := make([]string, len(spec.Key))
+	for i, k := range spec.Key {
+		keys[i] = pq.QuoteIdentifier(k)
+	}
+	return "ROW(" + strings.Join(keys, ", ") + ")::text", "ROW(" + quoteIdents(spec.Columns) + ")::text"
+}
+
+// tableBuckets returns count and order-independent hash per key bucket. Row hashes are
+// sorted before being combined, so physical row order does not matter.
+func tableBuckets(ctx context.Context, db *sqlx.DB, spec tableSpec, width int64) (map[int64]bucketSummary, error) {
+	_, row := rowTextExprs(spec)
+	q := fmt.Sprintf(`
+		SELECT %s AS bucket, count(*) AS row_count,
+		       md5(string_agg(md5(%s), '' ORDER BY md5(%s))) AS hash
+		FROM %s
+		GROUP BY 1
+	`, bucketExpr(spec), row, row, pq.QuoteIdentifier(spec.Name))
+
+	var buckets []bucketSummary
+	if err := selectStable(ctx, db, &buckets, q, width); err != nil {
+		return nil, err
+	}
+	out := make(map[int64]bucketSummary, len(buckets))
+	for _, b := range buckets {
+		out[b.Bucket] = b
+	}
+	return out, nil
+}
+
+// bucketRows returns the per-row hashes of one bucket.
+func bucketRows(ctx context.Context, db *sqlx.DB, spec tableSpec, width, bucket int64) ([]rowHash, error) {
+	key, row := rowTextExprs(spec)
+	q := fmt.Sprintf(`
+		SELECT %s AS key, md5(%s) AS hash
+		FROM %s
+		WHERE %s = $2
+		ORDER BY 1
+	`, key, row, pq.QuoteIdentifier(spec.Name), bucketExpr(spec))
+
+	var rows []rowHash
+	err := selectStable(ctx, db, &rows, q, width, bucket)
+	return rows, err
+}
+
+// selectStable runs a read-only query with session settings pinned, so timestamps and
+// floats render to the same text on both servers.
+func selectStable(ctx context.Context, db *sqlx.DB, dest interface{}, q string, args ...interface{}) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SET LOCAL TimeZone = 'UTC'; SET LOCAL extra_float_digits = 3"); err != nil {
+		return err
+	}
+	return tx.SelectContext(ctx, dest, q, args...)
+}
@@ -34,6 +34,7 @@ type Problem = {
   difficulty: Difficulty | null;
   acceptance: number | null;
   frequency: number | null;
+  popularity: number | null;
   tags: string[];
   other_companies: string[];
   completed: boolean;
@@ -77,6 +78,7 @@ async function fetchAllProblems() {
           difficulty,
           acceptance,
           frequency,
+          popularity,
           problem_tags ( tag ),
           company_problems (
             company:companies ( id, name ),
@@ -395,6 +397,7 @@ export default function AllProblems() {
         difficulty: p.difficulty ?? null,
         acceptance: p.acceptance ?? null,
         frequency: p.frequency ?? null,
+        popularity: p.popularity ?? null,
         tags: p.problem_tags?.map((t: any) => t.tag) ?? [],
         other_companies:
           p.company_problems
@@ -557,10 +560,20 @@ export default function AllProblems() {
         headerName: "Frequency",
         headerTooltip: "How frequently this problem is asked at this company.",
         width: 120,
-        sort: "desc",
         cellRenderer: FrequencyCellRenderer,
         comparator: (a, b) => (a ?? -1) - (b ?? -1),
       },
+      {
+        field: "popularity",
+        headerName: "Popularity",
+        headerTooltip:
+          "How widely this problem is asked: companies asking it, weighted by how recently and how frequently.",
+        width: 120,
+        sort: "desc",
+        valueFormatter: (params) =>
+          params.value == null ? "-" : params.value.toFixed(2),
+        comparator: (a, b) => (a ?? -1) - (b ?? -1),
+      },
       {
         field: "tags",
         headerName: "Tags",